@@ -1,15 +1,13 @@
 package audit
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"strings"
 	"time"
 
-	"github.com/IBM/sarama"
-	"github.com/bytedance/sonic"
-	"github.com/rs/xid"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto"
 	"github.com/AISHU-Technology/kweaver-go-lib/logger"
 	"github.com/AISHU-Technology/kweaver-go-lib/mq"
 	"github.com/AISHU-Technology/kweaver-go-lib/rest"
@@ -96,27 +94,98 @@ type AuditLog struct {
 	LogFrom     AuditLogFrom      `json:"log_from"`    // 日志来源
 	Detail      map[string]string `json:"detail"`      // 详情
 
-	Status string `json:"-"` // 状态
+	// 每种语言的日志描述, WithI18nDescription 配置多种语言时有效
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+
+	SchemaVersion string       `json:"schema_version"`    // 日志格式版本
+	Details       *AuditDetail `json:"details,omitempty"` // 结构化详情
+
+	// 哈希链, 开启 WithHashChain 时有效
+	ChainID   string `json:"chain_id,omitempty"`  // 链ID, 同一进程产生的审计日志属于同一条链
+	Seq       int64  `json:"seq,omitempty"`       // 在链中的序号, 从 1 开始
+	PrevHash  string `json:"prev_hash,omitempty"` // 前一条审计日志的哈希
+	Hash      string `json:"hash,omitempty"`      // 本条审计日志的哈希
+	Signature string `json:"signature,omitempty"` // 对哈希的签名
+
+	Status   string      `json:"-"` // 状态
+	Language string      `json:"-"` // 语言
+	Route    *AuditRoute `json:"-"` // 投递信息
 }
 
-var (
-	auditLogChan  chan *AuditLog = make(chan *AuditLog, 1000)
-	auditProducer sarama.SyncProducer
-)
+// 审计日志的可选配置
+type Option func(opts *auditOptions)
+
+type auditOptions struct {
+	spoolSetting    *SpoolSetting
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
+	batchSize       int
+	hashChain       bool
+	chainCipher     crypto.CipherV2
+
+	descriptionI18n  bool
+	descriptionLangs []string
+
+	topic        string
+	logFrom      *AuditLogFrom
+	idGenerator  func() (string, error)
+	tenantHeader string
+	tenant       string
+	partitionKey func(auditLog *AuditLog) string
+}
+
+// 开启审计日志落盘缓冲, sink 不可用时审计日志保存在本地段文件中, 恢复后按顺序重放
+func WithSpool(setting SpoolSetting) Option {
+	return func(opts *auditOptions) {
+		opts.spoolSetting = &setting
+	}
+}
+
+// 每次最多向 sink 发送 size 条审计日志, 默认为 1
+// 只合并已在队列中的审计日志, 不额外等待, 与 NewKafkaBatchSink 配合使用
+func WithBatchSize(size int) Option {
+	return func(opts *auditOptions) {
+		opts.batchSize = size
+	}
+}
 
-func Init(mqSetting *mq.MQSetting) {
+// 初始化审计日志, 输出到 mq
+func Init(mqSetting *mq.MQSetting, opts ...Option) {
 
 	// UT MODE, do nothing and return directly
 	if os.Getenv("AUDIT_MODE_UT") == "true" {
 		return
 	}
 
-	if mqSetting.MQType != "kafka" {
-		logger.Errorf("audit Init failed, mq type is not kafka, mq type is %s", mqSetting.MQType)
+	if mqSetting.MQType == mq.MQ_TYPE_KAFKA {
+		InitWithSink(NewKafkaSink(mqSetting), opts...)
 		return
 	}
 
-	go initAuditLogHandler(mqSetting)
+	producer, err := mq.NewProducer(mqSetting)
+	if err != nil {
+		logger.Errorf("audit Init failed, create %s producer failed: %v", mqSetting.MQType, err)
+		return
+	}
+	InitWithSink(NewMQSink(producer), opts...)
+}
+
+// 初始化审计日志, 输出到指定的 sink, 多个 sink 可通过 NewMultiSink 组合
+func InitWithSink(sink AuditSink, opts ...Option) {
+
+	// UT MODE, do nothing and return directly
+	if os.Getenv("AUDIT_MODE_UT") == "true" {
+		return
+	}
+
+	if err := defaultClient.start(sink, opts...); err != nil {
+		logger.Errorf("audit Init failed: %v", err)
+	}
+}
+
+// 获取落盘缓冲的统计信息, 未开启落盘缓冲时返回零值
+func GetSpoolStats() SpoolStats {
+	return defaultClient.GetSpoolStats()
 }
 
 func TransforOperator(visitor rest.Visitor) AuditOperator {
@@ -142,168 +211,295 @@ func TransforOperator(visitor rest.Visitor) AuditOperator {
 
 // 创建信息级别的审计日志
 func NewInfoLog(logType string, op string, operator AuditOperator, obj AuditObject, detail string) {
-	auditLog := AuditLog{
-		Type:      logType,
-		Level:     INFO,
-		Operation: op,
-		OpTime:    time.Now().UnixNano(),
-		Operator:  operator,
-		Object:    obj,
-		Status:    SUCCESS,
-		Detail: map[string]string{
-			"detail": detail,
-		},
+	if err := NewInfoLogCtx(context.Background(), logType, op, operator, obj, detail); err != nil {
+		logger.Errorf("new info auditLog failed: %v", err)
 	}
-
-	auditLogChan <- &auditLog
 }
 
 // 创建警告级别的审计日志
 func NewWarnLog(logType string, op string, operator AuditOperator, obj AuditObject, status string, detail string) {
-	auditLog := AuditLog{
-		Type:      logType,
-		Level:     WARN,
-		Operation: op,
-		OpTime:    time.Now().UnixNano(),
-		Operator:  operator,
-		Object:    obj,
-		Status:    status,
-		Detail: map[string]string{
-			"detail": detail,
-		},
+	if err := NewWarnLogCtx(context.Background(), logType, op, operator, obj, status, detail); err != nil {
+		logger.Errorf("new warn auditLog failed: %v", err)
 	}
-
-	auditLogChan <- &auditLog
 }
 
 // 创建警告级别的审计日志
 func NewWarnLogWithError(logType string, op string, operator AuditOperator, obj AuditObject, err *rest.BaseError) {
-	auditLog := AuditLog{
+	if enqueueErr := NewWarnLogWithErrorCtx(context.Background(), logType, op, operator, obj, err); enqueueErr != nil {
+		logger.Errorf("new warn auditLog failed: %v", enqueueErr)
+	}
+}
+
+// 使用默认实例创建审计日志, 同 Client.NewInfoLog
+func NewInfoLogCtx(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, detail string) error {
+	return defaultClient.NewInfoLog(ctx, logType, op, operator, obj, detail)
+}
+
+// 使用默认实例创建审计日志, 同 Client.NewWarnLog
+func NewWarnLogCtx(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, status string, detail string) error {
+	return defaultClient.NewWarnLog(ctx, logType, op, operator, obj, status, detail)
+}
+
+// 使用默认实例创建审计日志, 同 Client.NewWarnLogWithError
+func NewWarnLogWithErrorCtx(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, err *rest.BaseError) error {
+	return defaultClient.NewWarnLogWithError(ctx, logType, op, operator, obj, err)
+}
+
+// 构造审计日志, 未指定操作者时使用 ctx 中的访问者信息
+func newAuditLog(ctx context.Context, logType string, level string, op string, operator AuditOperator, obj AuditObject, status string, detail string) *AuditLog {
+	if operator.ID == "" {
+		if visitor, ok := rest.GetVisitorByCtx(ctx); ok {
+			operator = TransforOperator(visitor)
+		}
+	}
+
+	auditLog := &AuditLog{
 		Type:      logType,
-		Level:     WARN,
+		Level:     level,
 		Operation: op,
 		OpTime:    time.Now().UnixNano(),
 		Operator:  operator,
 		Object:    obj,
-		Status:    FAILED,
+		Status:    status,
+		Language:  rest.GetLanguageByCtx(ctx),
 		Detail: map[string]string{
-			"detail": err.Error(),
+			"detail": detail,
 		},
 	}
 
-	auditLogChan <- &auditLog
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.HasTraceID() {
+		auditLog.Detail["trace_id"] = spanCtx.TraceID().String()
+	}
+
+	return auditLog
 }
 
-// 处理审计日志
-func initAuditLogHandler(mqSetting *mq.MQSetting) {
+// 启动审计日志处理协程
+func (c *Client) startHandler() {
+
+	// 开启落盘缓冲时, 审计日志先写入段文件, 再由重放协程按顺序发送
+	if c.spool != nil {
+		writerDone := make(chan struct{})
+
+		c.wg.Add(2)
+		go func() {
+			defer c.wg.Done()
+			defer close(writerDone)
+			c.writeSpool()
+		}()
+		go func() {
+			defer c.wg.Done()
+			c.replaySpool(writerDone)
+		}()
+		return
+	}
 
-	auditProducer = getAuditProcuder(mqSetting, RECOVER_AUDIT_PRODUCER_INTERVAL)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.handleLogs()
+	}()
+}
 
-	//从channel中取数据
+// 从channel中取数据并发送, Shutdown 后排空队列再退出
+func (c *Client) handleLogs() {
 	for {
-		auditLog := <-auditLogChan
+		auditLogs, ok := c.receiveLogs()
+		if !ok {
+			return
+		}
 
 		// 处理审计日志
-		transformLog(auditLog)
+		for _, auditLog := range auditLogs {
+			c.transformLog(auditLog)
+		}
+		auditLogs = c.linkLogs(c.ctx, auditLogs)
 
 		// 发送审计日志
-		sendLog(auditLog)
+		if err := c.sendLogs(c.ctx, auditLogs); err != nil {
+			if deliveryErr, ok := err.(*DeliveryError); ok {
+				c.undelivered.Add(int64(len(deliveryErr.Failed)))
+			}
+		}
 	}
 }
 
-// 处理审计日志
-func transformLog(auditLog *AuditLog) {
-	auditLog.ID = xid.New().String()
-	auditLog.LogFrom = DEFAULT_AUDIT_LOG_FROM
+// 从channel中取数据写入落盘缓冲, Shutdown 后排空队列再退出
+// 从队列取出到写入落盘缓冲期间持有 spoolWriteMu, OVERFLOW_SPILL 不会插队到已取出的审计日志之前
+// 队列为空时持有锁阻塞不影响 OVERFLOW_SPILL, 因为只有队列满时才会写入落盘缓冲
+func (c *Client) writeSpool() {
+	for {
+		c.spoolWriteMu.Lock()
+		auditLogs, ok := c.receiveLogs()
+		if !ok {
+			c.spoolWriteMu.Unlock()
+			return
+		}
 
-	var logInfoArr []string
-	if auditLog.Operation != "" {
-		logInfoArr = append(logInfoArr, auditLog.Operation)
-	}
-	if auditLog.Object.Type != "" {
-		logInfoArr = append(logInfoArr, auditLog.Object.Type)
-	}
-	if auditLog.Object.Name != "" {
-		logInfoArr = append(logInfoArr, auditLog.Object.Name)
-	}
-	if auditLog.Status != "" {
-		logInfoArr = append(logInfoArr, auditLog.Status)
+		for _, auditLog := range auditLogs {
+			c.appendSpool(auditLog)
+		}
+		c.spoolWriteMu.Unlock()
 	}
-	auditLog.Description = strings.Join(logInfoArr, " ")
-
-	auditLog.Detail["status"] = auditLog.Status
 }
 
-// 往kafka发送审计日志
-func sendLog(auditLog *AuditLog) {
+// 处理审计日志并写入落盘缓冲, 写入失败时重试, 避免丢失, 调用方需持有 spoolWriteMu
+func (c *Client) appendSpool(auditLog *AuditLog) {
+	c.transformLog(auditLog)
 
-	auditLogStr, err := sonic.MarshalString(auditLog)
-	if err != nil {
-		logger.Errorf("marshal auditLog failed: %v", err)
-		return
+	for {
+		err := c.appendLinked(auditLog)
+		if err == nil {
+			return
+		}
+		logger.Errorf("append auditLog %v to spool failed: %v, will try again", auditLog, err)
+		if !sleepCtx(c.ctx, RECOVER_AUDIT_PRODUCER_INTERVAL) {
+			c.undelivered.Add(1)
+			return
+		}
 	}
+}
 
-	logger.Infof("audit log: %v", auditLogStr)
+// 写入落盘缓冲, 开启哈希链时写入成功后才加入哈希链, 写入失败不会在链中留下缺口
+func (c *Client) appendLinked(auditLog *AuditLog) error {
+	if c.chain == nil {
+		return c.spool.append(auditLog)
+	}
+	return c.chain.link(c.ctx, auditLog, func() error {
+		return c.spool.append(auditLog)
+	})
+}
 
-	// 构造一个消息
-	msg := &sarama.ProducerMessage{
-		Topic: AUDIT_TOPIC,
-		Value: sarama.StringEncoder(auditLogStr),
+// 阻塞获取一条审计日志, 再合并队列中已有的审计日志, 最多 WithBatchSize 条
+// Shutdown 后队列为空时返回 false
+func (c *Client) receiveLogs() ([]*AuditLog, bool) {
+	var auditLogs []*AuditLog
+	select {
+	case auditLog := <-c.logChan:
+		auditLogs = append(auditLogs, auditLog)
+	case <-c.stopCh:
+		select {
+		case auditLog := <-c.logChan:
+			auditLogs = append(auditLogs, auditLog)
+		default:
+			return nil, false
+		}
 	}
 
-	for {
-		// 发送消息
-		_, _, err = auditProducer.SendMessage(msg)
-		if err == nil {
-			return
+	for len(auditLogs) < c.opts.batchSize {
+		select {
+		case auditLog := <-c.logChan:
+			auditLogs = append(auditLogs, auditLog)
+		default:
+			return auditLogs, true
 		}
-		logger.Errorf("send auditLog %v failed: %v, will try again", auditLog, err)
-		time.Sleep(RECOVER_AUDIT_PRODUCER_INTERVAL)
 	}
+	return auditLogs, true
 }
 
-// 新建kafka生产者
-func newAuditProducer(mqSetting *mq.MQSetting) (sarama.SyncProducer, error) {
+// 按写入顺序重放落盘缓冲中的审计日志, 发送成功后推进 checkpoint
+// 写入协程退出且落盘缓冲为空时退出
+func (c *Client) replaySpool(writerDone chan struct{}) {
+	writerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-writerDone
+		cancel()
+	}()
 
-	hosts := []string{fmt.Sprintf("%s:%d", mqSetting.MQHost, mqSetting.MQPort)}
+	for {
+		auditLogs, err := c.spool.peek(writerCtx, c.opts.batchSize)
+		if err != nil {
+			if writerCtx.Err() != nil {
+				return
+			}
+			logger.Errorf("read auditLog from spool failed: %v, will try again", err)
+			if !sleepCtx(c.ctx, RECOVER_AUDIT_PRODUCER_INTERVAL) {
+				return
+			}
+			continue
+		}
 
-	config := sarama.NewConfig()
+		// 发送审计日志, Shutdown 超时时未发送的审计日志保留在落盘缓冲中
+		if err = c.sendLogs(c.ctx, auditLogs); err != nil {
+			return
+		}
 
-	config.Net.SASL.Enable = true
-	config.Net.SASL.Mechanism = sarama.SASLMechanism(mqSetting.Auth.Mechanism)
-	config.Net.SASL.User = mqSetting.Auth.Username
-	config.Net.SASL.Password = mqSetting.Auth.Password
+		if err = c.spool.ack(len(auditLogs)); err != nil {
+			logger.Errorf("ack %d auditLogs in spool failed: %v", len(auditLogs), err)
+		}
+	}
+}
+
+// 处理审计日志
+func (c *Client) transformLog(auditLog *AuditLog) {
+	auditLog.ID = c.generateID()
+	auditLog.LogFrom = DEFAULT_AUDIT_LOG_FROM
+	if c.opts.logFrom != nil {
+		auditLog.LogFrom = *c.opts.logFrom
+	}
+	auditLog.SchemaVersion = AUDIT_SCHEMA_VERSION
 
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Partitioner = sarama.NewRandomPartitioner
-	config.Producer.Return.Successes = true
-	config.Producer.Retry.Max = MAX_PRODUCER_RETRY
-	config.Net.MaxOpenRequests = NET_MAX_OPEN_REQUESTS
+	auditLog.Detail["status"] = auditLog.Status
+	c.describe(auditLog)
+	c.route(auditLog)
+}
 
-	// 连接kafka
-	producer, err := sarama.NewSyncProducer(hosts, config)
-	if err != nil {
-		logger.Errorf("can not connect to kafka ,create kafka producer failed: %v", err)
-		return nil, err
+// 将审计日志加入哈希链, 失败时重试, 直到成功或 ctx 结束, 返回加入成功的审计日志
+// 未加入的审计日志不发送, 计入未发送的条数, 避免发送没有哈希的审计日志
+func (c *Client) linkLogs(ctx context.Context, auditLogs []*AuditLog) []*AuditLog {
+	if c.chain == nil {
+		return auditLogs
 	}
 
-	logger.Debugf("Create producer on topic %s", AUDIT_TOPIC)
-	return producer, nil
+	for i, auditLog := range auditLogs {
+		for {
+			err := c.chain.link(ctx, auditLog, nil)
+			if err == nil {
+				break
+			}
+			logger.Errorf("link auditLog %v to hash chain failed: %v, will try again", auditLog, err)
+			if !sleepCtx(ctx, RECOVER_AUDIT_PRODUCER_INTERVAL) {
+				c.undelivered.Add(int64(len(auditLogs) - i))
+				return auditLogs[:i]
+			}
+		}
+	}
+	return auditLogs
 }
 
-// 获取auditProducer
-// 若获取auditProducer为nil时，过两分钟继续获取，实现kafka恢复正常后自动连接
-func getAuditProcuder(mqSetting *mq.MQSetting, interval time.Duration) sarama.SyncProducer {
+// 发送审计日志, 失败时每隔一段时间重试, 直到 sink 恢复正常或 ctx 结束
+// 部分发送失败时只重试发送失败的审计日志, ctx 结束时通过 DeliveryError 返回未发送的审计日志
+func (c *Client) sendLogs(ctx context.Context, auditLogs []*AuditLog) error {
 
-	logger.Infof("get auditProducer if auditProducer is nil, interval: %s", interval)
 	for {
-		producer, err := newAuditProducer(mqSetting)
-		if err != nil {
-			logger.Errorf("can not connect to kafka, create kafka producer failed: %v", err)
+		if ctx.Err() != nil {
+			return &DeliveryError{Failed: auditLogs, Err: ctx.Err()}
 		}
-		if producer != nil {
-			return producer
+
+		err := c.sink.Send(ctx, auditLogs)
+		if err == nil {
+			return nil
+		}
+		if deliveryErr, ok := err.(*DeliveryError); ok && len(deliveryErr.Failed) > 0 {
+			auditLogs = deliveryErr.Failed
 		}
-		time.Sleep(interval)
+		logger.Errorf("send %d auditLogs failed: %v, will try again", len(auditLogs), err)
+		if !sleepCtx(ctx, RECOVER_AUDIT_PRODUCER_INTERVAL) {
+			return &DeliveryError{Failed: auditLogs, Err: ctx.Err()}
+		}
+	}
+}
+
+// 等待一段时间, ctx 结束时提前返回 false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
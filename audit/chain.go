@@ -0,0 +1,271 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/rs/xid"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto"
+)
+
+// 哈希链校验发现的问题类型
+const (
+	CHAIN_GAP       = "gap"       // 缺少审计日志
+	CHAIN_REORDER   = "reorder"   // 审计日志顺序错乱
+	CHAIN_EDITED    = "edited"    // 审计日志内容被修改
+	CHAIN_BROKEN    = "broken"    // 前一条审计日志的哈希不匹配
+	CHAIN_SIGNATURE = "signature" // 签名不匹配
+)
+
+// 开启审计日志哈希链
+// 同一进程产生的审计日志属于同一条链, 每条审计日志记录序号和前一条审计日志的哈希
+// cipher 不为 nil 时, 对哈希做签名, 校验时使用对应的 crypto.VerifiableCipher 验签
+func WithHashChain(cipher crypto.CipherV2) Option {
+	return func(opts *auditOptions) {
+		opts.chainCipher = cipher
+		opts.hashChain = true
+	}
+}
+
+type hashChain struct {
+	mu       sync.Mutex
+	id       string
+	seq      int64
+	prevHash string
+	cipher   crypto.CipherV2
+}
+
+func newHashChain(cipher crypto.CipherV2) *hashChain {
+	return &hashChain{
+		id:     xid.New().String(),
+		cipher: cipher,
+	}
+}
+
+// 将审计日志加入哈希链, 调用顺序即链的顺序
+// commit 不为 nil 时在持有锁时调用, 如写入落盘缓冲, 返回错误时审计日志不加入哈希链, 不会留下缺口
+func (c *hashChain) link(ctx context.Context, auditLog *AuditLog, commit func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	auditLog.ChainID = c.id
+	auditLog.Seq = c.seq + 1
+	auditLog.PrevHash = c.prevHash
+
+	hash, err := hashAuditLog(auditLog)
+	if err != nil {
+		return err
+	}
+	auditLog.Hash = hash
+	if c.cipher != nil {
+		auditLog.Signature, err = c.cipher.Signature(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("sign auditLog hash failed: %w", err)
+		}
+	}
+	if commit != nil {
+		if err := commit(); err != nil {
+			return err
+		}
+	}
+
+	c.seq++
+	c.prevHash = hash
+	return nil
+}
+
+// 获取当前哈希链的ID和末尾, 未开启哈希链时返回 false
+// 可定期记录到审计日志以外的存储中, 校验时与 ChainVerifier.Heads 比较
+func (c *Client) ChainHead() (string, ChainHead, bool) {
+	if c.chain == nil {
+		return "", ChainHead{}, false
+	}
+
+	c.chain.mu.Lock()
+	defer c.chain.mu.Unlock()
+	return c.chain.id, ChainHead{Seq: c.chain.seq, Hash: c.chain.prevHash}, true
+}
+
+// 解析导出的审计日志时保留数字的原文, 避免大于 2^53 的整数丢失精度
+var chainJSON = sonic.Config{UseNumber: true}.Froze()
+
+// 计算审计日志的哈希, 不包括 Hash 和 Signature 字段
+// 对规范化的 JSON 计算哈希, 保证内存中的审计日志与导出后再解析的审计日志哈希一致
+func hashAuditLog(auditLog *AuditLog) (string, error) {
+	content := *auditLog
+	content.Hash = ""
+	content.Signature = ""
+
+	contentBytes, err := canonicalJSON(&content)
+	if err != nil {
+		return "", fmt.Errorf("marshal auditLog failed: %w", err)
+	}
+
+	sum := sha256.Sum256(contentBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// 序列化后按 UseNumber 解析, 再按排序后的 key 序列化
+// 结构体与解析后的 map 结果相同, 数字保持原文
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := sonic.ConfigStd.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// 哈希链校验发现的问题
+// Index: 审计日志在导出流中的位置, 从 0 开始
+type ChainViolation struct {
+	Index   int
+	ChainID string
+	Seq     int64
+	ID      string
+	Reason  string
+	Message string
+}
+
+// 哈希链校验器, 按导出顺序依次校验审计日志, 支持多条链交错
+// 重复投递的审计日志 (序号和哈希都相同) 不视为问题
+// 每条链从导出流中第一条审计日志开始校验, 因此可以校验从链中间开始的导出
+// 只能发现链中间的缺失, 不能发现末尾被截断或整条链被删除, 需要时另外记录每条链最后的序号和哈希, 与 Heads 比较
+type ChainVerifier struct {
+	cipher     crypto.VerifiableCipher
+	chains     map[string]*chainState
+	index      int
+	violations []ChainViolation
+}
+
+type chainState struct {
+	seq    int64
+	hashes map[int64]string
+}
+
+// cipher 不为 nil 时校验签名
+func NewChainVerifier(cipher crypto.VerifiableCipher) *ChainVerifier {
+	return &ChainVerifier{
+		cipher: cipher,
+		chains: map[string]*chainState{},
+	}
+}
+
+// 校验一条审计日志, 返回发现的问题
+// 从 JSON 解析审计日志时需保留数字原文 (UseNumber), 否则大于 2^53 的整数会被判定为修改
+func (v *ChainVerifier) Verify(auditLog *AuditLog) []ChainViolation {
+	index := v.index
+	v.index++
+
+	var violations []ChainViolation
+	report := func(reason string, format string, args ...interface{}) {
+		violations = append(violations, ChainViolation{
+			Index:   index,
+			ChainID: auditLog.ChainID,
+			Seq:     auditLog.Seq,
+			ID:      auditLog.ID,
+			Reason:  reason,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	hash, err := hashAuditLog(auditLog)
+	if err != nil || !hmac.Equal([]byte(hash), []byte(auditLog.Hash)) {
+		report(CHAIN_EDITED, "hash mismatch, expected %s, got %s", hash, auditLog.Hash)
+	}
+	if v.cipher != nil {
+		err := v.cipher.Verify(context.Background(), auditLog.Hash, auditLog.Signature)
+		if errors.Is(err, crypto.ErrSignatureMismatch) {
+			report(CHAIN_SIGNATURE, "signature of hash %s mismatch", auditLog.Hash)
+		} else if err != nil {
+			report(CHAIN_SIGNATURE, "verify signature of hash %s failed: %v", auditLog.Hash, err)
+		}
+	}
+
+	// 链中第一条出现的审计日志作为校验的起点
+	state, ok := v.chains[auditLog.ChainID]
+	if !ok {
+		state = &chainState{seq: auditLog.Seq - 1, hashes: map[int64]string{auditLog.Seq - 1: auditLog.PrevHash}}
+		v.chains[auditLog.ChainID] = state
+	}
+
+	switch {
+	case auditLog.Seq <= state.seq:
+		if state.hashes[auditLog.Seq] != auditLog.Hash {
+			report(CHAIN_REORDER, "seq %d after seq %d", auditLog.Seq, state.seq)
+		}
+		v.violations = append(v.violations, violations...)
+		return violations
+
+	case auditLog.Seq > state.seq+1:
+		report(CHAIN_GAP, "missing seq %d to %d", state.seq+1, auditLog.Seq-1)
+
+	case auditLog.PrevHash != state.hashes[state.seq]:
+		report(CHAIN_BROKEN, "prev hash %s mismatch, expected %s", auditLog.PrevHash, state.hashes[state.seq])
+	}
+
+	state.seq = auditLog.Seq
+	state.hashes[auditLog.Seq] = auditLog.Hash
+
+	v.violations = append(v.violations, violations...)
+	return violations
+}
+
+// 获取已发现的所有问题
+func (v *ChainVerifier) Violations() []ChainViolation {
+	return v.violations
+}
+
+// 链的末尾, 为已校验的最大序号和对应的哈希
+type ChainHead struct {
+	Seq  int64
+	Hash string
+}
+
+// 获取每条链已校验的末尾, 与另外记录的末尾比较, 可以发现末尾被截断或整条链被删除
+func (v *ChainVerifier) Heads() map[string]ChainHead {
+	heads := make(map[string]ChainHead, len(v.chains))
+	for chainID, state := range v.chains {
+		heads[chainID] = ChainHead{Seq: state.seq, Hash: state.hashes[state.seq]}
+	}
+	return heads
+}
+
+// 校验导出的审计日志流, 每行一条 JSON 格式的审计日志, 与 NewFileSink 的输出格式一致
+func VerifyChain(r io.Reader, cipher crypto.VerifiableCipher) ([]ChainViolation, error) {
+	verifier := NewChainVerifier(cipher)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var auditLog AuditLog
+		if err := chainJSON.Unmarshal(scanner.Bytes(), &auditLog); err != nil {
+			return verifier.Violations(), fmt.Errorf("unmarshal auditLog at line %d failed: %w", line, err)
+		}
+		verifier.Verify(&auditLog)
+	}
+	if err := scanner.Err(); err != nil {
+		return verifier.Violations(), err
+	}
+	return verifier.Violations(), nil
+}
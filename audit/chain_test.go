@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto"
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto/mock"
+)
+
+func TestHashChain(t *testing.T) {
+	Convey("test audit hash chain\n", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// 签名带时间戳, 每次不同, 只能通过 Verify 校验
+		cipher := mock.NewMockVerifiableCipher(ctrl)
+		signed := 0
+		cipher.EXPECT().Signature(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, content string) (string, error) {
+			signed++
+			return fmt.Sprintf("sig:%s:%d", content, signed), nil
+		}).AnyTimes()
+		cipher.EXPECT().Verify(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, content string, signature string) error {
+			if !strings.HasPrefix(signature, "sig:"+content+":") {
+				return crypto.ErrSignatureMismatch
+			}
+			return nil
+		}).AnyTimes()
+
+		chain := newHashChain(cipher)
+		auditLogs := []*AuditLog{}
+		for _, id := range []string{"1", "2", "3", "4"} {
+			auditLog := &AuditLog{ID: id, Operation: CREATE, Detail: map[string]string{"b": "2", "a": "1"}}
+			So(chain.link(context.Background(), auditLog, nil), ShouldBeNil)
+			auditLogs = append(auditLogs, auditLog)
+		}
+		So(auditLogs[0].Seq, ShouldEqual, 1)
+		So(auditLogs[0].PrevHash, ShouldEqual, "")
+		So(auditLogs[1].PrevHash, ShouldEqual, auditLogs[0].Hash)
+
+		export := func(auditLogs ...*AuditLog) string {
+			var buf bytes.Buffer
+			for _, auditLog := range auditLogs {
+				line, _ := sonic.Marshal(auditLog)
+				buf.Write(line)
+				buf.WriteByte('\n')
+			}
+			return buf.String()
+		}
+		reasons := func(violations []ChainViolation) []string {
+			var rs []string
+			for _, v := range violations {
+				rs = append(rs, v.Reason)
+			}
+			return rs
+		}
+
+		Convey("intact stream with duplicate delivery\n", func() {
+			violations, err := VerifyChain(strings.NewReader(export(auditLogs[0], auditLogs[1], auditLogs[1], auditLogs[2], auditLogs[3])), cipher)
+			So(err, ShouldBeNil)
+			So(violations, ShouldBeEmpty)
+		})
+
+		Convey("edited record\n", func() {
+			edited := *auditLogs[1]
+			edited.Operation = DELETE
+			violations, err := VerifyChain(strings.NewReader(export(auditLogs[0], &edited, auditLogs[2])), cipher)
+			So(err, ShouldBeNil)
+			So(reasons(violations), ShouldResemble, []string{CHAIN_EDITED})
+			So(violations[0].ID, ShouldEqual, "2")
+		})
+
+		Convey("rehashed record without key\n", func() {
+			edited := *auditLogs[1]
+			edited.Operation = DELETE
+			edited.Hash, _ = hashAuditLog(&edited)
+			violations, err := VerifyChain(strings.NewReader(export(auditLogs[0], &edited, auditLogs[2])), cipher)
+			So(err, ShouldBeNil)
+			So(reasons(violations), ShouldResemble, []string{CHAIN_SIGNATURE, CHAIN_BROKEN})
+		})
+
+		Convey("missing record\n", func() {
+			violations, err := VerifyChain(strings.NewReader(export(auditLogs[0], auditLogs[2], auditLogs[3])), cipher)
+			So(err, ShouldBeNil)
+			So(reasons(violations), ShouldResemble, []string{CHAIN_GAP})
+			So(violations[0].Index, ShouldEqual, 1)
+		})
+
+		Convey("reordered records\n", func() {
+			violations, err := VerifyChain(strings.NewReader(export(auditLogs[0], auditLogs[2], auditLogs[1], auditLogs[3])), cipher)
+			So(err, ShouldBeNil)
+			So(reasons(violations), ShouldResemble, []string{CHAIN_GAP, CHAIN_REORDER})
+		})
+
+		Convey("structured details survive export\n", func() {
+			type dataSource struct {
+				Name string `json:"name"`
+				Port int    `json:"port"`
+			}
+			detail := NewDetail().
+				WithValue("source", dataSource{Name: "mysql", Port: 3306}).
+				WithValue("big", int64(1<<60+1)).
+				WithChanges([]FieldChange{{Field: "quota", Before: uint64(1<<63 + 1), After: 0.5}})
+
+			chain := newHashChain(cipher)
+			auditLog := &AuditLog{ID: "5", Operation: UPDATE, Detail: map[string]string{}, Details: detail}
+			So(chain.link(context.Background(), auditLog, nil), ShouldBeNil)
+
+			violations, err := VerifyChain(strings.NewReader(export(auditLog)), cipher)
+			So(err, ShouldBeNil)
+			So(violations, ShouldBeEmpty)
+		})
+
+		Convey("export starting in the middle of the chain\n", func() {
+			verifier := NewChainVerifier(cipher)
+			for _, auditLog := range auditLogs[2:] {
+				So(verifier.Verify(auditLog), ShouldBeEmpty)
+			}
+			head := verifier.Heads()[auditLogs[3].ChainID]
+			So(head.Seq, ShouldEqual, 4)
+			So(head.Hash, ShouldEqual, auditLogs[3].Hash)
+		})
+
+		Convey("failed commit leaves no gap\n", func() {
+			auditLog := &AuditLog{ID: "5", Operation: CREATE, Detail: map[string]string{}}
+			err := chain.link(context.Background(), auditLog, func() error { return errors.New("disk full") })
+			So(err, ShouldNotBeNil)
+			So(chain.link(context.Background(), auditLog, nil), ShouldBeNil)
+			So(auditLog.Seq, ShouldEqual, 5)
+			So(auditLog.PrevHash, ShouldEqual, auditLogs[3].Hash)
+
+			violations, err := VerifyChain(strings.NewReader(export(auditLogs[3], auditLog)), cipher)
+			So(err, ShouldBeNil)
+			So(violations, ShouldBeEmpty)
+		})
+
+		Convey("signing failure is returned\n", func() {
+			failing := mock.NewMockCipherV2(ctrl)
+			failing.EXPECT().Signature(gomock.Any(), gomock.Any()).Return("", errors.New("hsm unavailable"))
+			auditLog := &AuditLog{ID: "6", Operation: CREATE, Detail: map[string]string{}}
+			So(newHashChain(failing).link(context.Background(), auditLog, nil), ShouldNotBeNil)
+		})
+	})
+}
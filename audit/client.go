@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/xid"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+const (
+	AUDIT_QUEUE_SIZE = 1000 // 审计日志队列长度
+
+	TENANT_HEADER = "x-tenant" // 租户的默认消息头
+)
+
+var (
+	ErrAuditStarted = errors.New("audit client is already started")
+)
+
+// 包级别的函数使用的默认实例, 由 Init 或 InitWithSink 启动
+var defaultClient = newClient()
+
+// 审计日志客户端, 每个实例有独立的队列、sink 和投递配置
+// 同一进程需要输出到多个 topic 或使用不同的日志来源时, 为每个租户创建一个 Client
+// NewInfoLog 等方法从 ctx 中获取 trace ID、语言和访问者信息, 队列满时按 WithOverflowPolicy 设置的策略处理, 审计日志未被接收时返回错误
+type Client struct {
+	opts auditOptions
+
+	logChan chan *AuditLog
+	sink    AuditSink
+	spool   *spool
+	chain   *hashChain
+	// 写入落盘缓冲的审计日志可能来自处理协程和 OVERFLOW_SPILL, 加锁保证处理顺序与写入顺序一致
+	spoolWriteMu sync.Mutex
+
+	// enqueue 持有读锁, Shutdown 持有写锁, 保证 Shutdown 之后不会再有审计日志进入队列
+	mu     sync.RWMutex
+	closed bool
+
+	// Shutdown 获取写锁之前关闭, 通知阻塞等待队列的 enqueue 返回并释放读锁
+	closingCh   chan struct{}
+	closingOnce sync.Once
+	// Shutdown 开始时关闭, 通知处理协程排空队列后退出
+	stopCh chan struct{}
+	// Shutdown 超时时取消, 结束发送重试
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg          sync.WaitGroup
+	started     atomic.Bool
+	undelivered atomic.Int64
+}
+
+// 创建审计日志客户端并启动处理协程, 输出到指定的 sink
+// Shutdown 时关闭 sink, 多个 Client 不能共用同一个 sink
+func NewClient(sink AuditSink, opts ...Option) (*Client, error) {
+	c := newClient()
+	if err := c.start(sink, opts...); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient() *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		opts: auditOptions{
+			overflowPolicy: OVERFLOW_BLOCK,
+			batchSize:      1,
+		},
+		logChan:   make(chan *AuditLog, AUDIT_QUEUE_SIZE),
+		closingCh: make(chan struct{}),
+		stopCh:    make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+func (c *Client) start(sink AuditSink, opts ...Option) error {
+	if c.started.Load() {
+		return ErrAuditStarted
+	}
+
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+
+	if c.opts.overflowPolicy == OVERFLOW_SPILL && c.opts.spoolSetting == nil {
+		logger.Warnf("audit overflow policy %s requires spool, fall back to %s", OVERFLOW_SPILL, OVERFLOW_BLOCK)
+		c.opts.overflowPolicy = OVERFLOW_BLOCK
+	}
+	if c.opts.batchSize < 1 {
+		c.opts.batchSize = 1
+	}
+	if c.opts.tenant != "" && c.opts.tenantHeader == "" {
+		c.opts.tenantHeader = TENANT_HEADER
+	}
+
+	if c.opts.spoolSetting != nil {
+		s, err := openSpool(*c.opts.spoolSetting)
+		if err != nil {
+			return fmt.Errorf("open audit spool failed: %w", err)
+		}
+		c.spool = s
+		registerSpoolMetrics(s)
+	}
+
+	if c.opts.hashChain {
+		c.chain = newHashChain(c.opts.chainCipher)
+	}
+
+	c.sink = sink
+	c.started.Store(true)
+	c.startHandler()
+	return nil
+}
+
+// 设置审计日志的 topic, 默认为 AUDIT_TOPIC, 只对 mq 类型的 sink 生效
+func WithTopic(topic string) Option {
+	return func(opts *auditOptions) {
+		opts.topic = topic
+	}
+}
+
+// 设置审计日志的来源, 默认为 DEFAULT_AUDIT_LOG_FROM
+func WithLogFrom(logFrom AuditLogFrom) Option {
+	return func(opts *auditOptions) {
+		opts.logFrom = &logFrom
+	}
+}
+
+// 设置审计日志ID的生成方式, 默认为 xid, 生成失败时使用 xid
+// 如使用分布式ID:
+//
+//	audit.WithIDGenerator(func() (string, error) {
+//		id, err := did.GenerateDistributedID()
+//		return strconv.FormatUint(id, 10), err
+//	})
+func WithIDGenerator(generator func() (string, error)) Option {
+	return func(opts *auditOptions) {
+		opts.idGenerator = generator
+	}
+}
+
+// 在审计日志的消息头中携带租户, header 为空时使用 TENANT_HEADER, 只对 mq 类型的 sink 生效
+func WithTenant(header string, tenant string) Option {
+	return func(opts *auditOptions) {
+		opts.tenantHeader = header
+		opts.tenant = tenant
+	}
+}
+
+// 设置审计日志的分区 key, 默认为操作者ID, 只对 mq 类型的 sink 生效
+func WithPartitionKey(partitionKey func(auditLog *AuditLog) string) Option {
+	return func(opts *auditOptions) {
+		opts.partitionKey = partitionKey
+	}
+}
+
+// 获取落盘缓冲的统计信息, 未开启落盘缓冲时返回零值
+func (c *Client) GetSpoolStats() SpoolStats {
+	if c.spool == nil {
+		return SpoolStats{}
+	}
+	return c.spool.stats()
+}
+
+// 创建信息级别的审计日志
+func (c *Client) NewInfoLog(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, detail string) error {
+	auditLog := newAuditLog(ctx, logType, INFO, op, operator, obj, SUCCESS, detail)
+	return c.enqueue(ctx, auditLog)
+}
+
+// 创建警告级别的审计日志
+func (c *Client) NewWarnLog(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, status string, detail string) error {
+	auditLog := newAuditLog(ctx, logType, WARN, op, operator, obj, status, detail)
+	return c.enqueue(ctx, auditLog)
+}
+
+// 创建警告级别的审计日志, 状态为失败, 详情为错误信息
+func (c *Client) NewWarnLogWithError(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, err *rest.BaseError) error {
+	auditLog := newAuditLog(ctx, logType, WARN, op, operator, obj, FAILED, err.Error())
+	return c.enqueue(ctx, auditLog)
+}
+
+// 生成审计日志ID
+func (c *Client) generateID() string {
+	if c.opts.idGenerator == nil {
+		return xid.New().String()
+	}
+
+	id, err := c.opts.idGenerator()
+	if err != nil || id == "" {
+		logger.Errorf("generate auditLog id failed: %v, use xid instead", err)
+		return xid.New().String()
+	}
+	return id
+}
+
+// 根据投递配置设置审计日志的 topic、分区 key 和消息头
+func (c *Client) route(auditLog *AuditLog) {
+	if c.opts.topic == "" && c.opts.tenant == "" && c.opts.partitionKey == nil {
+		return
+	}
+
+	route := &AuditRoute{
+		Topic: c.opts.topic,
+	}
+	if c.opts.partitionKey != nil {
+		route.Key = c.opts.partitionKey(auditLog)
+	}
+	if c.opts.tenant != "" {
+		route.Headers = map[string]string{
+			c.opts.tenantHeader: c.opts.tenant,
+		}
+	}
+	auditLog.Route = route
+}
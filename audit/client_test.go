@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/mq"
+)
+
+func TestClient(t *testing.T) {
+	Convey("test audit client routes audit logs per tenant\n", t, func() {
+		setting := &mq.MQSetting{MQType: mq.MQ_TYPE_MEMORY, MQHost: "audit-client"}
+		broker := mq.GetMemoryBroker(setting)
+		broker.Reset()
+
+		newTenantClient := func(tenant string) *Client {
+			producer, err := mq.NewProducer(setting)
+			So(err, ShouldBeNil)
+
+			c, err := NewClient(NewMQSink(producer),
+				WithTopic(tenant+".audit_log"),
+				WithLogFrom(AuditLogFrom{Service: AuditLogFromService{Name: tenant + "-gateway"}}),
+				WithIDGenerator(func() (string, error) { return tenant + "-1", nil }),
+				WithTenant("", tenant),
+				WithPartitionKey(func(auditLog *AuditLog) string { return auditLog.Object.ID }),
+			)
+			So(err, ShouldBeNil)
+			return c
+		}
+
+		for _, tenant := range []string{"t1", "t2"} {
+			c := newTenantClient(tenant)
+			err := c.NewInfoLog(context.Background(), OPERATION, CREATE, AuditOperator{ID: "u1"}, AuditObject{ID: "o1"}, "")
+			So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			msgs, err := broker.WaitMessages(ctx, tenant+".audit_log", 1)
+			cancel()
+			So(err, ShouldBeNil)
+			So(string(msgs[0].Key), ShouldEqual, "o1")
+			So(msgs[0].Headers[TENANT_HEADER], ShouldEqual, tenant)
+
+			var received AuditLog
+			So(sonic.Unmarshal(msgs[0].Value, &received), ShouldBeNil)
+			So(received.ID, ShouldEqual, tenant+"-1")
+			So(received.LogFrom.Service.Name, ShouldEqual, tenant+"-gateway")
+
+			_, err = c.Shutdown(context.Background())
+			So(err, ShouldBeNil)
+		}
+		So(len(broker.Messages(AUDIT_TOPIC)), ShouldEqual, 0)
+	})
+
+	Convey("test audit client defaults\n", t, func() {
+		c := newClient()
+		auditLog := newAuditLog(context.Background(), OPERATION, INFO, CREATE, AuditOperator{ID: "u1"}, AuditObject{}, SUCCESS, "")
+		c.transformLog(auditLog)
+		So(auditLog.ID, ShouldNotBeEmpty)
+		So(auditLog.LogFrom, ShouldResemble, DEFAULT_AUDIT_LOG_FROM)
+		So(auditLog.Route, ShouldBeNil)
+		So(routeTopic(auditLog), ShouldEqual, AUDIT_TOPIC)
+		So(routeKey(auditLog), ShouldEqual, "u1")
+
+		Convey("fall back to xid when id generator fails\n", func() {
+			c.opts.idGenerator = func() (string, error) { return "", errors.New("no machine id") }
+			c.transformLog(auditLog)
+			So(auditLog.ID, ShouldNotBeEmpty)
+		})
+
+		Convey("start twice\n", func() {
+			So(c.start(&flakySink{}), ShouldBeNil)
+			So(c.start(&flakySink{}), ShouldEqual, ErrAuditStarted)
+			_, err := c.Shutdown(context.Background())
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("test route is kept in spool\n", t, func() {
+		s, err := openSpool(SpoolSetting{Dir: t.TempDir()})
+		So(err, ShouldBeNil)
+		defer s.close()
+
+		route := &AuditRoute{Topic: "t1.audit_log", Key: "o1", Headers: map[string]string{TENANT_HEADER: "t1"}}
+		So(s.append(&AuditLog{ID: "1", Detail: map[string]string{}, Route: route}), ShouldBeNil)
+
+		auditLogs, err := s.peek(context.Background(), 1)
+		So(err, ShouldBeNil)
+		So(auditLogs[0].ID, ShouldEqual, "1")
+		So(auditLogs[0].Route, ShouldResemble, route)
+	})
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"strings"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/i18n"
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+)
+
+const (
+	// 审计日志描述模板的 messageId 前缀, 完整的 messageId 为 Audit.<日志类型>.<操作类型>, 如 Audit.operation.create
+	// 模板数据包括 Operation、Status、Object、Operator、Detail 和 Details, 如:
+	//   [Audit.operation]
+	//   create = "{{.Operator.Name}} 创建了{{.Object.Type}} {{.Object.Name}}"
+	DESCRIPTION_MESSAGE_PREFIX = "Audit"
+)
+
+// 使用 i18n 模板生成审计日志描述, 模板不存在或执行失败时使用默认的英文描述
+// langs 为空时使用请求的语言 (ctx 中的语言, 默认为 rest.DefaultLanguage)
+// langs 不为空时 Description 使用 langs[0], 多于一种语言时每种语言的描述保存在 Descriptions 中
+func WithI18nDescription(langs ...string) Option {
+	return func(opts *auditOptions) {
+		opts.descriptionI18n = true
+		opts.descriptionLangs = langs
+	}
+}
+
+// 生成审计日志描述
+func (c *Client) describe(auditLog *AuditLog) {
+	if !c.opts.descriptionI18n {
+		auditLog.Description = defaultDescription(auditLog)
+		return
+	}
+
+	if len(c.opts.descriptionLangs) == 0 {
+		auditLog.Description = translateDescription(auditLog, auditLog.Language)
+		return
+	}
+
+	auditLog.Description = translateDescription(auditLog, c.opts.descriptionLangs[0])
+	if len(c.opts.descriptionLangs) > 1 {
+		auditLog.Descriptions = make(map[string]string, len(c.opts.descriptionLangs))
+		for _, lang := range c.opts.descriptionLangs {
+			auditLog.Descriptions[lang] = translateDescription(auditLog, lang)
+		}
+	}
+}
+
+func translateDescription(auditLog *AuditLog, lang string) string {
+	messageId := strings.Join([]string{DESCRIPTION_MESSAGE_PREFIX, auditLog.Type, auditLog.Operation}, ".")
+	if !i18n.Exists(lang, messageId) {
+		return defaultDescription(auditLog)
+	}
+
+	description, err := i18n.TranslateWithError(lang, messageId, map[string]interface{}{
+		"Operation": auditLog.Operation,
+		"Status":    auditLog.Status,
+		"Object":    auditLog.Object,
+		"Operator":  auditLog.Operator,
+		"Detail":    auditLog.Detail,
+		"Details":   auditLog.Details,
+	})
+	if err != nil {
+		logger.Errorf("translate audit log description failed, use the default description: %v", err)
+		return defaultDescription(auditLog)
+	}
+	return description
+}
+
+// 默认的英文描述, 由操作类型、对象类型、对象名称和状态组成
+func defaultDescription(auditLog *AuditLog) string {
+	var logInfoArr []string
+	if auditLog.Operation != "" {
+		logInfoArr = append(logInfoArr, auditLog.Operation)
+	}
+	if auditLog.Object.Type != "" {
+		logInfoArr = append(logInfoArr, auditLog.Object.Type)
+	}
+	if auditLog.Object.Name != "" {
+		logInfoArr = append(logInfoArr, auditLog.Object.Name)
+	}
+	if auditLog.Status != "" {
+		logInfoArr = append(logInfoArr, auditLog.Status)
+	}
+	return strings.Join(logInfoArr, " ")
+}
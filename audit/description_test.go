@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/i18n"
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+func TestDescribe(t *testing.T) {
+	dir := t.TempDir()
+	locales := map[string]string{
+		"audit.zh-CN.toml": "[Audit.operation]\n" +
+			`create = '创建{{.Object.Type}} {{.Object.Name}}{{if eq .Status "success"}}成功{{else}}失败{{end}}'` + "\n" +
+			`update = '修改{{.Object.Name}}, 请求 {{.Details.RequestID}}'`,
+		"audit.en-US.toml": "[Audit.operation]\n" +
+			`create = 'Created {{.Object.Type}} {{.Object.Name}}, detail: {{.Detail.detail}}'` + "\n" +
+			`update = 'Updated {{.Object.Name}}, request {{.Details.RequestID}}'`,
+	}
+	for name, content := range locales {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i18n.RegisterI18n(dir)
+
+	Convey("test localized audit description\n", t, func() {
+		c := newClient()
+
+		newLog := func(op string) *AuditLog {
+			return &AuditLog{
+				Type:      OPERATION,
+				Operation: op,
+				Status:    SUCCESS,
+				Language:  rest.SimplifiedChinese,
+				Object:    AuditObject{Type: "dataview", Name: "foo"},
+				Detail:    map[string]string{"detail": "d"},
+			}
+		}
+
+		Convey("default english description\n", func() {
+			auditLog := newLog(CREATE)
+			c.describe(auditLog)
+			So(auditLog.Description, ShouldEqual, "create dataview foo success")
+		})
+
+		Convey("request language\n", func() {
+			c.opts.descriptionI18n = true
+			auditLog := newLog(CREATE)
+			c.describe(auditLog)
+			So(auditLog.Description, ShouldEqual, "创建dataview foo成功")
+			So(auditLog.Descriptions, ShouldBeNil)
+		})
+
+		Convey("configured languages\n", func() {
+			c.opts.descriptionI18n = true
+			c.opts.descriptionLangs = []string{rest.AmericanEnglish, rest.SimplifiedChinese}
+			auditLog := newLog(CREATE)
+			c.describe(auditLog)
+			So(auditLog.Description, ShouldEqual, "Created dataview foo, detail: d")
+			So(auditLog.Descriptions[rest.SimplifiedChinese], ShouldEqual, "创建dataview foo成功")
+		})
+
+		Convey("fall back when template is missing\n", func() {
+			c.opts.descriptionI18n = true
+			auditLog := newLog(DELETE)
+			c.describe(auditLog)
+			So(auditLog.Description, ShouldEqual, "delete dataview foo success")
+		})
+
+		Convey("fall back when template execution fails\n", func() {
+			c.opts.descriptionI18n = true
+			auditLog := newLog(UPDATE)
+			c.describe(auditLog)
+			So(auditLog.Description, ShouldEqual, "update dataview foo success")
+
+			auditLog = newLog(UPDATE)
+			auditLog.Details = &AuditDetail{RequestID: "r1"}
+			c.describe(auditLog)
+			So(auditLog.Description, ShouldEqual, "修改foo, 请求 r1")
+		})
+	})
+}
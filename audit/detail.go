@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	// 审计日志格式的版本, 增加结构化详情后为 2.0
+	AUDIT_SCHEMA_VERSION = "2.0"
+
+	// 结构体字段的 audit tag
+	// audit:"-" 对比时忽略该字段
+	// audit:"mask" 对比时只记录是否变化, 不记录具体的值, 用于密码、密钥等敏感字段
+	AUDIT_TAG       = "audit"
+	AUDIT_TAG_SKIP  = "-"
+	AUDIT_TAG_MASK  = "mask"
+	AUDIT_MASK_TEXT = "******"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// 结构化的审计日志详情
+// RequestID、TraceID: 请求ID和 trace ID, TraceID 为空时从 ctx 中获取
+// Changes: 修改操作的字段级变化
+// Values: 其他任意可序列化为 JSON 的值
+type AuditDetail struct {
+	RequestID string                 `json:"request_id,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	Changes   []FieldChange          `json:"changes,omitempty"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+}
+
+// 字段的变化
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+func NewDetail() *AuditDetail {
+	return &AuditDetail{}
+}
+
+// 对比修改前后的两个结构体, 生成 UPDATE 操作的详情
+func NewUpdateDetail(before interface{}, after interface{}) (*AuditDetail, error) {
+	changes, err := Diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditDetail{Changes: changes}, nil
+}
+
+func (d *AuditDetail) WithRequestID(requestID string) *AuditDetail {
+	d.RequestID = requestID
+	return d
+}
+
+func (d *AuditDetail) WithTraceID(traceID string) *AuditDetail {
+	d.TraceID = traceID
+	return d
+}
+
+func (d *AuditDetail) WithChanges(changes []FieldChange) *AuditDetail {
+	d.Changes = append(d.Changes, changes...)
+	return d
+}
+
+func (d *AuditDetail) WithValue(key string, value interface{}) *AuditDetail {
+	if d.Values == nil {
+		d.Values = make(map[string]interface{})
+	}
+	d.Values[key] = value
+	return d
+}
+
+// 创建带结构化详情的信息级别审计日志
+func NewInfoLogWithDetail(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, detail *AuditDetail) error {
+	return defaultClient.NewInfoLogWithDetail(ctx, logType, op, operator, obj, detail)
+}
+
+// 创建带结构化详情的警告级别审计日志
+func NewWarnLogWithDetail(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, status string, detail *AuditDetail) error {
+	return defaultClient.NewWarnLogWithDetail(ctx, logType, op, operator, obj, status, detail)
+}
+
+// 创建带结构化详情的信息级别审计日志
+func (c *Client) NewInfoLogWithDetail(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, detail *AuditDetail) error {
+	auditLog := newAuditLog(ctx, logType, INFO, op, operator, obj, SUCCESS, "")
+	auditLog.Details = completeDetail(auditLog, detail)
+	return c.enqueue(ctx, auditLog)
+}
+
+// 创建带结构化详情的警告级别审计日志
+func (c *Client) NewWarnLogWithDetail(ctx context.Context, logType string, op string, operator AuditOperator, obj AuditObject, status string, detail *AuditDetail) error {
+	auditLog := newAuditLog(ctx, logType, WARN, op, operator, obj, status, "")
+	auditLog.Details = completeDetail(auditLog, detail)
+	return c.enqueue(ctx, auditLog)
+}
+
+// 补充 ctx 中的 trace ID
+func completeDetail(auditLog *AuditLog, detail *AuditDetail) *AuditDetail {
+	if detail == nil {
+		detail = NewDetail()
+	}
+	if detail.TraceID == "" {
+		detail.TraceID = auditLog.Detail["trace_id"]
+	}
+	return detail
+}
+
+// 对比两个相同类型的结构体 (或结构体指针), 返回字段级的变化
+// 字段名使用 json tag, 嵌套的结构体展开为 a.b 的形式, 其他类型的字段整体比较
+// 不导出的字段和 json:"-" 的字段不参与对比; 新增或删除时 before 或 after 可为 nil, 按零值对比
+func Diff(before interface{}, after interface{}) ([]FieldChange, error) {
+	beforeV := indirect(reflect.ValueOf(before))
+	afterV := indirect(reflect.ValueOf(after))
+
+	if !beforeV.IsValid() && !afterV.IsValid() {
+		return nil, nil
+	}
+	if !beforeV.IsValid() {
+		beforeV = reflect.Zero(afterV.Type())
+	}
+	if !afterV.IsValid() {
+		afterV = reflect.Zero(beforeV.Type())
+	}
+
+	if beforeV.Type() != afterV.Type() {
+		return nil, fmt.Errorf("diff type mismatch, before is %s, after is %s", beforeV.Type(), afterV.Type())
+	}
+	if beforeV.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("diff only supports struct, got %s", beforeV.Type())
+	}
+
+	var changes []FieldChange
+	diffStruct("", beforeV, afterV, &changes)
+	return changes, nil
+}
+
+func diffStruct(prefix string, before reflect.Value, after reflect.Value, changes *[]FieldChange) {
+	t := before.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// 与 json 一致, 不导出的匿名嵌入结构体的字段也参与对比
+		if !field.IsExported() && !(field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct) {
+			continue
+		}
+
+		name := fieldName(field)
+		auditTag := field.Tag.Get(AUDIT_TAG)
+		if name == "" || auditTag == AUDIT_TAG_SKIP {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		beforeF := before.Field(i)
+		afterF := after.Field(i)
+
+		// 匿名嵌入的结构体不增加前缀
+		if field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct {
+			name = prefix
+		}
+
+		if indirectType(field.Type).Kind() == reflect.Struct && auditTag != AUDIT_TAG_MASK && !isLeafStruct(field.Type) {
+			b, a := indirect(beforeF), indirect(afterF)
+			if b.IsValid() && a.IsValid() {
+				diffStruct(name, b, a, changes)
+				continue
+			}
+		}
+
+		// 不导出的匿名嵌入结构体指针为 nil 时无法读取
+		if !field.IsExported() {
+			continue
+		}
+
+		if reflect.DeepEqual(beforeF.Interface(), afterF.Interface()) {
+			continue
+		}
+
+		change := FieldChange{
+			Field:  name,
+			Before: beforeF.Interface(),
+			After:  afterF.Interface(),
+		}
+		if auditTag == AUDIT_TAG_MASK {
+			change.Before = AUDIT_MASK_TEXT
+			change.After = AUDIT_MASK_TEXT
+		}
+		*changes = append(*changes, change)
+	}
+}
+
+// 获取字段的 json 名称, json:"-" 时返回空
+func fieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// time.Time 等实现了 json.Marshaler 的结构体整体比较
+func isLeafStruct(t reflect.Type) bool {
+	t = indirectType(t)
+	return t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType)
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
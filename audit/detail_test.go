@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type diffAddress struct {
+	City string `json:"city"`
+}
+
+type diffBase struct {
+	ID string `json:"id"`
+}
+
+type diffUser struct {
+	diffBase
+	Name     string            `json:"name"`
+	Password string            `json:"password" audit:"mask"`
+	Token    string            `json:"-"`
+	Version  int               `json:"version" audit:"-"`
+	Address  *diffAddress      `json:"address,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Updated  time.Time         `json:"updated"`
+	internal string
+}
+
+func TestDiff(t *testing.T) {
+	Convey("test struct diff\n", t, func() {
+		now := time.Now()
+		before := diffUser{
+			diffBase: diffBase{ID: "1"},
+			Name:     "a",
+			Password: "p1",
+			Token:    "t1",
+			Version:  1,
+			Address:  &diffAddress{City: "x"},
+			Tags:     []string{"t"},
+			Updated:  now,
+			internal: "i1",
+		}
+
+		Convey("no change\n", func() {
+			after := before
+			changes, err := Diff(&before, &after)
+			So(err, ShouldBeNil)
+			So(changes, ShouldBeEmpty)
+		})
+
+		Convey("field level changes\n", func() {
+			after := before
+			after.ID = "2"
+			after.Name = "b"
+			after.Password = "p2"
+			after.Token = "t2"
+			after.Version = 2
+			after.Address = &diffAddress{City: "y"}
+			after.Tags = []string{"t", "u"}
+			after.Updated = now.Add(time.Second)
+			after.internal = "i2"
+
+			changes, err := Diff(before, after)
+			So(err, ShouldBeNil)
+
+			fields := map[string]FieldChange{}
+			for _, change := range changes {
+				fields[change.Field] = change
+			}
+			So(len(fields), ShouldEqual, 6)
+			So(fields["id"].After, ShouldEqual, "2")
+			So(fields["name"].Before, ShouldEqual, "a")
+			So(fields["password"].After, ShouldEqual, AUDIT_MASK_TEXT)
+			So(fields["address.city"].After, ShouldEqual, "y")
+			So(fields["tags"].After, ShouldResemble, []string{"t", "u"})
+			So(fields, ShouldContainKey, "updated")
+		})
+
+		Convey("create from nil\n", func() {
+			changes, err := Diff(nil, &diffUser{Name: "a"})
+			So(err, ShouldBeNil)
+			So(len(changes), ShouldEqual, 1)
+			So(changes[0].Field, ShouldEqual, "name")
+		})
+
+		Convey("type mismatch\n", func() {
+			_, err := Diff(diffUser{}, diffAddress{})
+			So(err, ShouldNotBeNil)
+			_, err = Diff(1, 2)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("test audit log with structured detail\n", t, func() {
+		origClient := defaultClient
+		defaultClient = newClient()
+		defer func() { defaultClient = origClient }()
+
+		detail, err := NewUpdateDetail(diffUser{Name: "a"}, diffUser{Name: "b"})
+		So(err, ShouldBeNil)
+		detail.WithRequestID("r1").WithValue("count", 3)
+
+		err = NewInfoLogWithDetail(context.Background(), OPERATION, UPDATE, AuditOperator{}, AuditObject{}, detail)
+		So(err, ShouldBeNil)
+
+		auditLog := <-defaultClient.logChan
+		defaultClient.transformLog(auditLog)
+		So(auditLog.SchemaVersion, ShouldEqual, AUDIT_SCHEMA_VERSION)
+
+		auditLogStr, err := sonic.MarshalString(auditLog)
+		So(err, ShouldBeNil)
+		So(auditLogStr, ShouldContainSubstring, `"changes":[{"field":"name","before":"a","after":"b"}]`)
+		So(auditLogStr, ShouldContainSubstring, `"request_id":"r1"`)
+	})
+}
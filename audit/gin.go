@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID" // 请求ID, 记录到审计日志的结构化详情中
+
+	routeAuditKey = "X-Audit-Route"
+)
+
+// 路由的审计配置
+// Object: 请求处理完成后调用, 提取操作对象, 可读取路径参数和 handler 中设置的值
+// Detail: 请求处理完成后调用, 提取成功时的详情, 可为空
+type RouteAudit struct {
+	LogType   string
+	Operation string
+	Object    func(c *gin.Context) AuditObject
+	Detail    func(c *gin.Context) string
+}
+
+// 审计中间件, 请求处理完成后自动产生审计日志
+// 响应码小于 400 且没有调用 rest.ReplyError 时产生信息级别的审计日志, 否则产生警告级别的审计日志
+// 请求头中的 X-Request-ID 记录到结构化详情中
+// 操作者取自 rest.VerifyToken 校验通过的访问者, 可在路由上使用, 也可全局使用后由 handler 调用 Annotate 设置
+// 没有设置 LogType 或 Operation 的请求不产生审计日志
+func Middleware(route RouteAudit) gin.HandlerFunc {
+	return defaultClient.Middleware(route)
+}
+
+// 审计中间件, 审计日志由当前 Client 产生
+func (ac *Client) Middleware(route RouteAudit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(routeAuditKey, &route)
+
+		c.Next()
+
+		v, _ := c.Get(routeAuditKey)
+		r := v.(*RouteAudit)
+		if r.LogType == "" || r.Operation == "" {
+			return
+		}
+
+		if err := ac.emitRouteAudit(c, r); err != nil {
+			logger.Errorf("emit auditLog for %s %s failed: %v", c.Request.Method, c.FullPath(), err)
+		}
+	}
+}
+
+// handler 中补充或覆盖当前请求的审计配置, 只覆盖不为空的字段
+// 需要在 Middleware 之后调用
+func Annotate(c *gin.Context, route RouteAudit) {
+	v, ok := c.Get(routeAuditKey)
+	if !ok {
+		logger.Warnf("audit Annotate for %s %s ignored, audit middleware is not used", c.Request.Method, c.FullPath())
+		return
+	}
+
+	// 复制一份, 避免修改路由上共享的配置
+	r := *v.(*RouteAudit)
+	if route.LogType != "" {
+		r.LogType = route.LogType
+	}
+	if route.Operation != "" {
+		r.Operation = route.Operation
+	}
+	if route.Object != nil {
+		r.Object = route.Object
+	}
+	if route.Detail != nil {
+		r.Detail = route.Detail
+	}
+	c.Set(routeAuditKey, &r)
+}
+
+// handler 中设置当前请求的操作对象
+func SetObject(c *gin.Context, obj AuditObject) {
+	Annotate(c, RouteAudit{
+		Object: func(c *gin.Context) AuditObject { return obj },
+	})
+}
+
+func (ac *Client) emitRouteAudit(c *gin.Context, route *RouteAudit) error {
+	// 请求结束后客户端可能已断开, 不使用请求 ctx 的取消信号, 避免审计日志无法入队
+	ctx := context.WithoutCancel(rest.GetLanguageCtx(c))
+
+	var operator AuditOperator
+	if visitor, ok := rest.GetVisitor(c); ok {
+		operator = TransforOperator(visitor)
+	}
+
+	var obj AuditObject
+	if route.Object != nil {
+		obj = route.Object(c)
+	}
+
+	level, status, detail := INFO, SUCCESS, ""
+	statusCode := c.Writer.Status()
+	switch err := rest.GetReplyError(c).(type) {
+	case nil:
+		if statusCode >= http.StatusBadRequest {
+			level, status, detail = WARN, FAILED, http.StatusText(statusCode)
+		} else if route.Detail != nil {
+			detail = route.Detail(c)
+		}
+	case *rest.HTTPError:
+		level, status, detail = WARN, FAILED, err.BaseError.Error()
+	default:
+		level, status, detail = WARN, FAILED, err.Error()
+	}
+
+	auditLog := newAuditLog(ctx, route.LogType, level, route.Operation, operator, obj, status, detail)
+	auditLog.Details = completeDetail(auditLog, NewDetail().WithRequestID(c.GetHeader(REQUEST_ID_HEADER)))
+	return ac.enqueue(ctx, auditLog)
+}
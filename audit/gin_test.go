@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+func TestMiddleware(t *testing.T) {
+	Convey("test audit gin middleware\n", t, func() {
+		origClient := defaultClient
+		defaultClient = newClient()
+		defer func() { defaultClient = origClient }()
+
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.Use(func(c *gin.Context) {
+			c.Set(string(rest.VisitorKey), rest.Visitor{ID: "u1", Type: rest.VisitorType_RealName})
+		})
+
+		route := RouteAudit{
+			LogType:   OPERATION,
+			Operation: DELETE,
+			Object: func(c *gin.Context) AuditObject {
+				return AuditObject{Type: "model", ID: c.Param("id")}
+			},
+		}
+		engine.DELETE("/ok/:id", Middleware(route), func(c *gin.Context) {
+			rest.ReplyOK(c, http.StatusNoContent, nil)
+		})
+		engine.DELETE("/http_error/:id", Middleware(route), func(c *gin.Context) {
+			rest.ReplyError(c, rest.NewHTTPError(c, http.StatusNotFound, rest.PublicError_NotFound))
+		})
+		engine.DELETE("/error/:id", Middleware(route), func(c *gin.Context) {
+			rest.ReplyError(c, errors.New("boom"))
+		})
+		engine.POST("/annotate", Middleware(RouteAudit{}), func(c *gin.Context) {
+			Annotate(c, RouteAudit{LogType: MANAGEMENT, Operation: CREATE})
+			SetObject(c, AuditObject{Type: "model", Name: "m1"})
+			rest.ReplyOK(c, http.StatusCreated, nil)
+		})
+		engine.GET("/skip", Middleware(RouteAudit{}), func(c *gin.Context) {
+			rest.ReplyOK(c, http.StatusOK, nil)
+		})
+
+		serve := func(method, path string) {
+			engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+		}
+
+		Convey("success\n", func() {
+			serve(http.MethodDelete, "/ok/1")
+			auditLog := <-defaultClient.logChan
+			So(auditLog.Level, ShouldEqual, INFO)
+			So(auditLog.Status, ShouldEqual, SUCCESS)
+			So(auditLog.Object.ID, ShouldEqual, "1")
+			So(auditLog.Operator.ID, ShouldEqual, "u1")
+		})
+
+		Convey("http error\n", func() {
+			serve(http.MethodDelete, "/http_error/2")
+			auditLog := <-defaultClient.logChan
+			So(auditLog.Level, ShouldEqual, WARN)
+			So(auditLog.Status, ShouldEqual, FAILED)
+			So(auditLog.Object.ID, ShouldEqual, "2")
+			So(auditLog.Detail["detail"], ShouldContainSubstring, rest.PublicError_NotFound)
+		})
+
+		Convey("other error\n", func() {
+			serve(http.MethodDelete, "/error/3")
+			auditLog := <-defaultClient.logChan
+			So(auditLog.Level, ShouldEqual, WARN)
+			So(auditLog.Detail["detail"], ShouldEqual, "boom")
+		})
+
+		Convey("annotated by handler\n", func() {
+			serve(http.MethodPost, "/annotate")
+			auditLog := <-defaultClient.logChan
+			So(auditLog.Type, ShouldEqual, MANAGEMENT)
+			So(auditLog.Operation, ShouldEqual, CREATE)
+			So(auditLog.Object.Name, ShouldEqual, "m1")
+		})
+
+		Convey("not annotated\n", func() {
+			serve(http.MethodGet, "/skip")
+			So(len(defaultClient.logChan), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+// 审计日志 webhook 配置项
+// URL: 接收审计日志的地址, 以 JSON 数组的形式 POST
+// Headers: 额外的请求头, 如认证信息
+// TimeOut: 请求超时时间, 单位为秒
+type HTTPSinkSetting struct {
+	URL     string            `json:"url"     mapstructure:"url"`
+	Headers map[string]string `json:"headers" mapstructure:"headers"`
+	TimeOut int               `json:"timeOut" mapstructure:"timeOut"`
+}
+
+// 输出到 HTTP webhook
+type httpSink struct {
+	setting HTTPSinkSetting
+	client  rest.HTTPClient
+}
+
+func NewHTTPSink(setting HTTPSinkSetting) AuditSink {
+	if setting.TimeOut <= 0 {
+		setting.TimeOut = 30
+	}
+	return &httpSink{
+		setting: setting,
+		client:  rest.NewHTTPClientWithOptions(rest.HttpClientOptions{TimeOut: setting.TimeOut}),
+	}
+}
+
+func (s *httpSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	body, err := sonic.Marshal(auditLogs)
+	if err != nil {
+		return fmt.Errorf("marshal auditLog failed: %w", err)
+	}
+
+	headers := map[string]string{
+		rest.ContentTypeKey: rest.ContentTypeJson,
+	}
+	for k, v := range s.setting.Headers {
+		headers[k] = v
+	}
+
+	respCode, respBody, err := s.client.PostNoUnmarshal(ctx, s.setting.URL, headers, body)
+	if err != nil {
+		return fmt.Errorf("post auditLog to %s failed: %w", s.setting.URL, err)
+	}
+	if respCode < http.StatusOK || respCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("post auditLog to %s failed, httpCode: %d, body: %s", s.setting.URL, respCode, string(respBody))
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
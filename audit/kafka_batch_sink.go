@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/bytedance/sonic"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/mq"
+)
+
+// kafka 批量异步发送配置项
+// Linger: 消息在客户端攒批的最长等待时间
+// BatchSize: 攒批的最大消息条数, 达到后立即发送
+// Compression: 压缩算法, 可选 none、gzip、snappy、lz4、zstd, 默认 none
+type KafkaBatchSetting struct {
+	Linger      time.Duration `json:"linger"      mapstructure:"linger"`
+	BatchSize   int           `json:"batchSize"   mapstructure:"batchSize"`
+	Compression string        `json:"compression" mapstructure:"compression"`
+}
+
+// 部分审计日志发送失败, 重试时只需重新发送 Failed 中的审计日志
+// Failed 保持原来的顺序, 包括发送失败的审计日志, 以及其后 topic 和分区 key 相同的审计日志 (即使已发送成功)
+type DeliveryError struct {
+	Failed []*AuditLog
+	Err    error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%d audit logs delivery failed: %v", len(e.Failed), e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// 批量异步输出到 kafka
+// 以操作者ID作为消息的 key, 同一操作者的审计日志写入同一分区, 保证分区内有序
+type kafkaBatchSink struct {
+	mu        sync.Mutex
+	mqSetting *mq.MQSetting
+	setting   KafkaBatchSetting
+	producer  sarama.AsyncProducer
+}
+
+func NewKafkaBatchSink(mqSetting *mq.MQSetting, setting KafkaBatchSetting) AuditSink {
+	return &kafkaBatchSink{
+		mqSetting: mqSetting,
+		setting:   setting,
+	}
+}
+
+// 消息的 Metadata, 用于把发送结果对应回审计日志
+// 上一批因 ctx 结束而未收集的发送结果会在下一批中被忽略
+type batchItem struct {
+	batch *[]bool
+	index int
+}
+
+// 发送一批审计日志, 等待所有消息的发送结果后返回
+// 调用方需保证同一时刻只有一个协程调用 Send
+func (s *kafkaBatchSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	delivered := make([]bool, len(auditLogs))
+	msgs := make([]*sarama.ProducerMessage, 0, len(auditLogs))
+	for i, auditLog := range auditLogs {
+		auditLogStr, err := sonic.MarshalString(auditLog)
+		if err != nil {
+			return fmt.Errorf("marshal auditLog failed: %w", err)
+		}
+
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic:    routeTopic(auditLog),
+			Key:      recordKey(auditLog),
+			Value:    sarama.StringEncoder(auditLogStr),
+			Headers:  recordHeaders(auditLog),
+			Metadata: batchItem{batch: &delivered, index: i},
+		})
+	}
+
+	producer, err := s.getProducer()
+	if err != nil {
+		return err
+	}
+
+	// 投递消息的同时接收发送结果, 避免结果 channel 写满导致阻塞
+	var lastErr error
+	sent, pending := 0, len(msgs)
+	for pending > 0 {
+		var input chan<- *sarama.ProducerMessage
+		var next *sarama.ProducerMessage
+		if sent < len(msgs) {
+			input = producer.Input()
+			next = msgs[sent]
+		}
+
+		select {
+		case input <- next:
+			sent++
+		case msg := <-producer.Successes():
+			item := msg.Metadata.(batchItem)
+			if item.batch != &delivered {
+				continue
+			}
+			delivered[item.index] = true
+			pending--
+		case perr := <-producer.Errors():
+			item := perr.Msg.Metadata.(batchItem)
+			if item.batch != &delivered {
+				continue
+			}
+			logger.Errorf("send auditLog failed: %v", perr.Err)
+			lastErr = perr.Err
+			pending--
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	failed := make([]bool, len(delivered))
+	for i, ok := range delivered {
+		failed[i] = !ok
+	}
+	return newDeliveryError(auditLogs, failed, lastErr)
+}
+
+// 根据发送失败的审计日志生成 DeliveryError, 没有失败时返回 nil
+// 同一 topic 和分区 key 的审计日志中, 第一条失败之后的都需要重新发送, 否则重试后 key 内的顺序会错乱
+// 分区 key 为空的审计日志分散到各个分区, 不保证顺序, 只重新发送失败的
+func newDeliveryError(auditLogs []*AuditLog, failed []bool, err error) error {
+	var retry []*AuditLog
+	failedKeys := map[string]bool{}
+	for i, auditLog := range auditLogs {
+		key := routeKey(auditLog)
+		orderKey := routeTopic(auditLog) + "\x00" + key
+		switch {
+		case failed[i]:
+			if key != "" {
+				failedKeys[orderKey] = true
+			}
+		case failedKeys[orderKey]:
+		default:
+			continue
+		}
+		retry = append(retry, auditLog)
+	}
+
+	if len(retry) == 0 {
+		return nil
+	}
+	return &DeliveryError{Failed: retry, Err: err}
+}
+
+func (s *kafkaBatchSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer == nil {
+		return nil
+	}
+	err := s.producer.Close()
+	s.producer = nil
+	return err
+}
+
+// 获取kafka生产者, 为nil时重新连接, 实现kafka恢复正常后自动连接
+func (s *kafkaBatchSink) getProducer() (sarama.AsyncProducer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer != nil {
+		return s.producer, nil
+	}
+
+	config, err := newAuditProducerConfig(s.mqSetting)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Frequency = s.setting.Linger
+	config.Producer.Flush.Messages = s.setting.BatchSize
+	if s.setting.Compression != "" {
+		if err := config.Producer.Compression.UnmarshalText([]byte(s.setting.Compression)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 连接kafka
+	producer, err := sarama.NewAsyncProducer(mq.GetBrokers(s.mqSetting), config)
+	if err != nil {
+		logger.Errorf("can not connect to kafka ,create kafka async producer failed: %v", err)
+		return nil, err
+	}
+
+	logger.Debugf("Create async audit producer")
+	s.producer = producer
+	return producer, nil
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKafkaBatchSink(t *testing.T) {
+	Convey("test kafka batch sink\n", t, func() {
+		config := sarama.NewConfig()
+		config.Producer.Return.Successes = true
+		producer := mocks.NewAsyncProducer(t, config)
+		defer producer.Close()
+
+		sink := &kafkaBatchSink{producer: producer}
+		auditLogs := []*AuditLog{
+			{ID: "1", Operator: AuditOperator{ID: "u1"}},
+			{ID: "2", Operator: AuditOperator{ID: "u1"}},
+			{ID: "3", Operator: AuditOperator{ID: "u2"}},
+		}
+
+		Convey("all delivered\n", func() {
+			producer.ExpectInputAndSucceed()
+			producer.ExpectInputAndSucceed()
+			producer.ExpectInputAndSucceed()
+			So(sink.Send(context.Background(), auditLogs), ShouldBeNil)
+		})
+
+		Convey("only failed audit logs are returned\n", func() {
+			producer.ExpectInputAndSucceed()
+			producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+			producer.ExpectInputAndSucceed()
+
+			err := sink.Send(context.Background(), auditLogs)
+			deliveryErr, ok := err.(*DeliveryError)
+			So(ok, ShouldBeTrue)
+			So(len(deliveryErr.Failed), ShouldEqual, 1)
+			So(deliveryErr.Failed[0].ID, ShouldEqual, "2")
+			So(errors.Is(err, sarama.ErrNotLeaderForPartition), ShouldBeTrue)
+		})
+
+		Convey("later audit logs with the same key are retried\n", func() {
+			producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+			producer.ExpectInputAndSucceed()
+			producer.ExpectInputAndSucceed()
+
+			err := sink.Send(context.Background(), auditLogs)
+			deliveryErr, ok := err.(*DeliveryError)
+			So(ok, ShouldBeTrue)
+			So(len(deliveryErr.Failed), ShouldEqual, 2)
+			So(deliveryErr.Failed[0].ID, ShouldEqual, "1")
+			So(deliveryErr.Failed[1].ID, ShouldEqual, "2")
+		})
+	})
+}
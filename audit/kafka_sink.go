@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/bytedance/sonic"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/mq"
+)
+
+// 输出到 kafka
+type kafkaSink struct {
+	mu        sync.Mutex
+	mqSetting *mq.MQSetting
+	producer  sarama.SyncProducer
+}
+
+func NewKafkaSink(mqSetting *mq.MQSetting) AuditSink {
+	return &kafkaSink{
+		mqSetting: mqSetting,
+	}
+}
+
+func (s *kafkaSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(auditLogs))
+	for i, auditLog := range auditLogs {
+		auditLogStr, err := sonic.MarshalString(auditLog)
+		if err != nil {
+			return fmt.Errorf("marshal auditLog failed: %w", err)
+		}
+
+		logger.Infof("audit log: %v", auditLogStr)
+
+		// 构造一个消息
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic:    routeTopic(auditLog),
+			Key:      recordKey(auditLog),
+			Value:    sarama.StringEncoder(auditLogStr),
+			Headers:  recordHeaders(auditLog),
+			Metadata: i,
+		})
+	}
+
+	producer, err := s.getProducer()
+	if err != nil {
+		return err
+	}
+
+	// 发送消息
+	return syncDeliveryError(auditLogs, producer.SendMessages(msgs))
+}
+
+// 将同步发送的错误转换为 DeliveryError, 与 kafkaBatchSink 的重试方式一致
+// 不是逐条消息的错误时, 整批审计日志都需要重新发送
+func syncDeliveryError(auditLogs []*AuditLog, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	failed := make([]bool, len(auditLogs))
+	var producerErrs sarama.ProducerErrors
+	if errors.As(err, &producerErrs) {
+		for _, producerErr := range producerErrs {
+			if index, ok := producerErr.Msg.Metadata.(int); ok && index < len(failed) {
+				failed[index] = true
+			}
+		}
+	} else {
+		for i := range failed {
+			failed[i] = true
+		}
+	}
+
+	if deliveryErr := newDeliveryError(auditLogs, failed, err); deliveryErr != nil {
+		return deliveryErr
+	}
+	return &DeliveryError{Failed: auditLogs, Err: err}
+}
+
+func (s *kafkaSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer == nil {
+		return nil
+	}
+	err := s.producer.Close()
+	s.producer = nil
+	return err
+}
+
+// 获取kafka生产者, 为nil时重新连接, 实现kafka恢复正常后自动连接
+func (s *kafkaSink) getProducer() (sarama.SyncProducer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.producer != nil {
+		return s.producer, nil
+	}
+
+	producer, err := newAuditProducer(s.mqSetting)
+	if err != nil {
+		return nil, err
+	}
+	s.producer = producer
+	return producer, nil
+}
+
+// 新建kafka生产者
+func newAuditProducer(mqSetting *mq.MQSetting) (sarama.SyncProducer, error) {
+
+	config, err := newAuditProducerConfig(mqSetting)
+	if err != nil {
+		return nil, err
+	}
+	// key 为空时随机选择分区
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+
+	// 连接kafka
+	producer, err := sarama.NewSyncProducer(mq.GetBrokers(mqSetting), config)
+	if err != nil {
+		logger.Errorf("can not connect to kafka ,create kafka producer failed: %v", err)
+		return nil, err
+	}
+
+	logger.Debugf("Create audit producer")
+	return producer, nil
+}
+
+// 审计日志的分区 key 转换为 kafka 消息的 Key, 为空时不设置, 消息分散到各个分区
+func recordKey(auditLog *AuditLog) sarama.Encoder {
+	key := routeKey(auditLog)
+	if key == "" {
+		return nil
+	}
+	return sarama.StringEncoder(key)
+}
+
+// 审计日志的投递 Headers 转换为 kafka 消息的 Headers
+func recordHeaders(auditLog *AuditLog) []sarama.RecordHeader {
+	headers := routeHeaders(auditLog)
+	if len(headers) == 0 {
+		return nil
+	}
+
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return recordHeaders
+}
+
+// 生产者的公共配置
+func newAuditProducerConfig(mqSetting *mq.MQSetting) (*sarama.Config, error) {
+	config, err := mq.NewSaramaConfig(mqSetting)
+	if err != nil {
+		logger.Errorf("create kafka config failed: %v", err)
+		return nil, err
+	}
+
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = MAX_PRODUCER_RETRY
+	config.Net.MaxOpenRequests = NET_MAX_OPEN_REQUESTS
+
+	return config, nil
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKafkaSink(t *testing.T) {
+	Convey("test kafka sink\n", t, func() {
+		auditLogs := []*AuditLog{
+			{ID: "1", Operator: AuditOperator{ID: "u1"}},
+			{ID: "2", Operator: AuditOperator{ID: "u2"}},
+			{ID: "3", Operator: AuditOperator{ID: "u1"}},
+			{ID: "4"},
+		}
+		ids := func(err error) []string {
+			var deliveryErr *DeliveryError
+			So(errors.As(err, &deliveryErr), ShouldBeTrue)
+			var ids []string
+			for _, auditLog := range deliveryErr.Failed {
+				ids = append(ids, auditLog.ID)
+			}
+			return ids
+		}
+
+		Convey("failed messages and later messages with the same key are returned\n", func() {
+			err := syncDeliveryError(auditLogs, sarama.ProducerErrors{
+				{Msg: &sarama.ProducerMessage{Metadata: 0}, Err: sarama.ErrNotLeaderForPartition},
+			})
+			So(ids(err), ShouldResemble, []string{"1", "3"})
+
+			err = syncDeliveryError(auditLogs, sarama.ProducerErrors{
+				{Msg: &sarama.ProducerMessage{Metadata: 3}, Err: sarama.ErrNotLeaderForPartition},
+			})
+			So(ids(err), ShouldResemble, []string{"4"})
+		})
+
+		Convey("audit logs without operator have no key\n", func() {
+			config := sarama.NewConfig()
+			config.Producer.Return.Successes = true
+			producer := mocks.NewSyncProducer(t, config)
+			defer producer.Close()
+			keys := []sarama.Encoder{}
+			for range auditLogs {
+				producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+					keys = append(keys, msg.Key)
+					return nil
+				})
+			}
+
+			sink := &kafkaSink{producer: producer}
+			So(sink.Send(context.Background(), auditLogs), ShouldBeNil)
+			So(keys, ShouldResemble, []sarama.Encoder{
+				sarama.StringEncoder("u1"), sarama.StringEncoder("u2"), sarama.StringEncoder("u1"), nil,
+			})
+		})
+
+		Convey("other errors resend the whole batch\n", func() {
+			config := sarama.NewConfig()
+			config.Producer.Return.Successes = true
+			producer := mocks.NewSyncProducer(t, config)
+			defer producer.Close()
+			for range auditLogs {
+				producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+			}
+
+			sink := &kafkaSink{producer: producer}
+			err := sink.Send(context.Background(), auditLogs)
+			So(ids(err), ShouldResemble, []string{"1", "2", "3", "4"})
+			So(errors.Is(err, sarama.ErrOutOfBrokers), ShouldBeTrue)
+
+			So(syncDeliveryError(auditLogs, nil), ShouldBeNil)
+		})
+	})
+}
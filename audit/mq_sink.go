@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/mq"
+)
+
+// 通过 mq.Producer 输出, 用于 kafka 以外的 mq 类型
+type mqSink struct {
+	producer mq.Producer
+}
+
+func NewMQSink(producer mq.Producer) AuditSink {
+	return &mqSink{
+		producer: producer,
+	}
+}
+
+func (s *mqSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	msgs := make([]*mq.Message, 0, len(auditLogs))
+	for _, auditLog := range auditLogs {
+		auditLogBytes, err := sonic.Marshal(auditLog)
+		if err != nil {
+			return fmt.Errorf("marshal auditLog failed: %w", err)
+		}
+
+		logger.Infof("audit log: %s", auditLogBytes)
+
+		// Headers 会被注入 trace 上下文, 复制一份
+		headers := make(map[string]string, len(routeHeaders(auditLog)))
+		for k, v := range routeHeaders(auditLog) {
+			headers[k] = v
+		}
+
+		// 没有分区 key 的审计日志不设置 Key, 消息分散到各个分区
+		var key []byte
+		if k := routeKey(auditLog); k != "" {
+			key = []byte(k)
+		}
+
+		msgs = append(msgs, &mq.Message{
+			Topic:   routeTopic(auditLog),
+			Key:     key,
+			Value:   auditLogBytes,
+			Headers: headers,
+		})
+	}
+
+	return s.producer.Publish(ctx, msgs...)
+}
+
+func (s *mqSink) Close() error {
+	return s.producer.Close()
+}
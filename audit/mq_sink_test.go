@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/mq"
+	"github.com/AISHU-Technology/kweaver-go-lib/mq/mock"
+)
+
+func TestMQSink(t *testing.T) {
+	Convey("test mq sink\n", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		producer := mock.NewMockProducer(ctrl)
+		sink := NewMQSink(producer)
+
+		producer.EXPECT().Publish(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, msgs ...*mq.Message) error {
+				So(len(msgs), ShouldEqual, 2)
+				So(msgs[0].Topic, ShouldEqual, AUDIT_TOPIC)
+				So(string(msgs[0].Key), ShouldEqual, "u1")
+				So(msgs[1].Key, ShouldBeNil)
+				return nil
+			})
+		producer.EXPECT().Close().Return(nil)
+
+		err := sink.Send(context.Background(), []*AuditLog{{ID: "1", Operator: AuditOperator{ID: "u1"}}, {ID: "2"}})
+		So(err, ShouldBeNil)
+		So(sink.Close(), ShouldBeNil)
+	})
+
+	Convey("test mq sink with memory broker\n", t, func() {
+		setting := &mq.MQSetting{MQType: mq.MQ_TYPE_MEMORY, MQHost: "audit"}
+		producer, err := mq.NewProducer(setting)
+		So(err, ShouldBeNil)
+
+		sink := NewMQSink(producer)
+		auditLog := &AuditLog{ID: "1", Operation: CREATE}
+		So(sink.Send(context.Background(), []*AuditLog{auditLog}), ShouldBeNil)
+
+		msgs := mq.GetMemoryBroker(setting).Messages(AUDIT_TOPIC)
+		So(len(msgs), ShouldEqual, 1)
+
+		var received AuditLog
+		So(sonic.Unmarshal(msgs[0].Value, &received), ShouldBeNil)
+		So(received.ID, ShouldEqual, "1")
+		So(received.Operation, ShouldEqual, CREATE)
+	})
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bytedance/sonic"
+	"github.com/opensearch-project/opensearch-go/v2"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+// 输出到 opensearch, 使用 bulk 接口批量写入
+type openSearchSink struct {
+	client *opensearch.Client
+	index  string
+}
+
+func NewOpenSearchSink(cfg rest.OpenSearchClientConfig, index string) AuditSink {
+	return &openSearchSink{
+		client: rest.NewOpenSearchClient(cfg),
+		index:  index,
+	}
+}
+
+// bulk 接口的返回结果, 只解析需要的字段
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string      `json:"_id"`
+		Status int         `json:"status"`
+		Error  interface{} `json:"error"`
+	} `json:"items"`
+}
+
+func (s *openSearchSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	var buf bytes.Buffer
+	for _, auditLog := range auditLogs {
+		// 以审计日志ID作为文档ID, 重复发送时覆盖而不是新增
+		action, _ := sonic.Marshal(map[string]map[string]string{
+			"index": {"_id": auditLog.ID},
+		})
+		doc, err := sonic.Marshal(auditLog)
+		if err != nil {
+			return fmt.Errorf("marshal auditLog failed: %w", err)
+		}
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(doc)
+		buf.WriteByte('\n')
+	}
+
+	res, err := s.client.Bulk(&buf,
+		s.client.Bulk.WithContext(ctx),
+		s.client.Bulk.WithIndex(s.index))
+	if err != nil {
+		return fmt.Errorf("bulk index auditLog failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("read bulk response failed: %w", err)
+	}
+	if res.IsError() {
+		return fmt.Errorf("bulk index auditLog failed: %s", string(resBytes))
+	}
+
+	var bulkRes bulkResponse
+	if err = sonic.Unmarshal(resBytes, &bulkRes); err != nil {
+		return fmt.Errorf("unmarshal bulk response failed: %w", err)
+	}
+	if !bulkRes.Errors {
+		return nil
+	}
+
+	for _, item := range bulkRes.Items {
+		for _, result := range item {
+			if result.Error != nil {
+				return fmt.Errorf("bulk index auditLog %s failed, status: %d, error: %v", result.ID, result.Status, result.Error)
+			}
+		}
+	}
+	return fmt.Errorf("bulk index auditLog failed: %s", string(resBytes))
+}
+
+func (s *openSearchSink) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+)
+
+// 审计日志队列满时的处理策略
+type OverflowPolicy string
+
+const (
+	OVERFLOW_BLOCK       OverflowPolicy = "block"       // 阻塞等待, 超时或 ctx 结束时返回错误
+	OVERFLOW_DROP_OLDEST OverflowPolicy = "drop_oldest" // 丢弃队列中最早的审计日志
+	OVERFLOW_DROP_NEWEST OverflowPolicy = "drop_newest" // 丢弃当前的审计日志并返回错误
+	OVERFLOW_SPILL       OverflowPolicy = "spill"       // 直接写入落盘缓冲, 需同时开启 WithSpool
+)
+
+var (
+	ErrAuditLogDropped = errors.New("audit log dropped, the audit log queue is full")
+	ErrAuditLogTimeout = errors.New("audit log enqueue timeout, the audit log queue is full")
+)
+
+// 设置审计日志队列满时的处理策略
+// timeout 只对 OVERFLOW_BLOCK 生效, 为 0 时一直阻塞直到 ctx 结束
+func WithOverflowPolicy(policy OverflowPolicy, timeout time.Duration) Option {
+	return func(opts *auditOptions) {
+		opts.overflowPolicy = policy
+		opts.overflowTimeout = timeout
+	}
+}
+
+// 将审计日志放入队列, 队列满时按策略处理, 审计日志未被接收时返回错误
+func (c *Client) enqueue(ctx context.Context, auditLog *AuditLog) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return ErrAuditClosed
+	}
+
+	select {
+	case c.logChan <- auditLog:
+		return nil
+	default:
+	}
+
+	switch c.opts.overflowPolicy {
+	case OVERFLOW_DROP_NEWEST:
+		return ErrAuditLogDropped
+
+	case OVERFLOW_DROP_OLDEST:
+		for {
+			select {
+			case c.logChan <- auditLog:
+				return nil
+			default:
+			}
+
+			select {
+			case dropped := <-c.logChan:
+				logger.Warnf("audit log queue is full, drop the oldest auditLog %v", dropped)
+			default:
+			}
+		}
+
+	case OVERFLOW_SPILL:
+		if c.spool != nil {
+			return c.spill(auditLog)
+		}
+	}
+
+	var timeoutC <-chan time.Time
+	if c.opts.overflowTimeout > 0 {
+		timer := time.NewTimer(c.opts.overflowTimeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	select {
+	case c.logChan <- auditLog:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeoutC:
+		return ErrAuditLogTimeout
+	case <-c.closingCh:
+		return ErrAuditClosed
+	}
+}
+
+// 队列满时写入落盘缓冲, 先将队列中已有的审计日志按顺序写入, 保证落盘顺序与进入队列的顺序一致
+func (c *Client) spill(auditLog *AuditLog) error {
+	c.spoolWriteMu.Lock()
+	defer c.spoolWriteMu.Unlock()
+
+	for drained := false; !drained; {
+		select {
+		case queued := <-c.logChan:
+			c.appendSpool(queued)
+		default:
+			drained = true
+		}
+	}
+
+	c.transformLog(auditLog)
+	return c.appendLinked(auditLog)
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/rest"
+)
+
+func TestEnqueue(t *testing.T) {
+	Convey("test enqueue when the audit log queue is full\n", t, func() {
+		c := newClient()
+		c.logChan = make(chan *AuditLog, 1)
+
+		ctx := rest.WithVisitor(context.Background(), rest.Visitor{ID: "u1", Type: rest.VisitorType_RealName})
+		err := c.NewInfoLog(ctx, OPERATION, CREATE, AuditOperator{}, AuditObject{Name: "first"}, "")
+		So(err, ShouldBeNil)
+
+		Convey("operator is taken from the visitor in ctx\n", func() {
+			auditLog := <-c.logChan
+			So(auditLog.Operator.ID, ShouldEqual, "u1")
+			So(auditLog.Operator.Type, ShouldEqual, "authenticated_user")
+		})
+
+		Convey("drop newest\n", func() {
+			c.opts.overflowPolicy = OVERFLOW_DROP_NEWEST
+			err = c.NewInfoLog(ctx, OPERATION, CREATE, AuditOperator{}, AuditObject{Name: "second"}, "")
+			So(err, ShouldEqual, ErrAuditLogDropped)
+			So((<-c.logChan).Object.Name, ShouldEqual, "first")
+		})
+
+		Convey("drop oldest\n", func() {
+			c.opts.overflowPolicy = OVERFLOW_DROP_OLDEST
+			err = c.NewInfoLog(ctx, OPERATION, CREATE, AuditOperator{}, AuditObject{Name: "second"}, "")
+			So(err, ShouldBeNil)
+			So((<-c.logChan).Object.Name, ShouldEqual, "second")
+		})
+
+		Convey("block with timeout\n", func() {
+			c.opts.overflowPolicy = OVERFLOW_BLOCK
+			c.opts.overflowTimeout = 10 * time.Millisecond
+			err = c.NewInfoLog(ctx, OPERATION, CREATE, AuditOperator{}, AuditObject{Name: "second"}, "")
+			So(err, ShouldEqual, ErrAuditLogTimeout)
+		})
+
+		Convey("spill keeps the queue order\n", func() {
+			s, err := openSpool(SpoolSetting{Dir: t.TempDir()})
+			So(err, ShouldBeNil)
+			defer s.close()
+			c.spool = s
+			c.opts.overflowPolicy = OVERFLOW_SPILL
+
+			err = c.NewInfoLog(ctx, OPERATION, CREATE, AuditOperator{}, AuditObject{Name: "second"}, "")
+			So(err, ShouldBeNil)
+			So(len(c.logChan), ShouldEqual, 0)
+
+			auditLogs, err := s.peek(context.Background(), 2)
+			So(err, ShouldBeNil)
+			So(len(auditLogs), ShouldEqual, 2)
+			So(auditLogs[0].Object.Name, ShouldEqual, "first")
+			So(auditLogs[1].Object.Name, ShouldEqual, "second")
+		})
+	})
+}
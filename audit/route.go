@@ -0,0 +1,33 @@
+package audit
+
+// 审计日志的投递信息, 由 Client 根据 WithTopic、WithTenant、WithPartitionKey 设置
+// 不属于审计日志的内容, 只用于 mq 类型的 sink
+type AuditRoute struct {
+	Topic   string            `json:"topic,omitempty"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// 获取审计日志的 topic, 未设置时使用 AUDIT_TOPIC
+func routeTopic(auditLog *AuditLog) string {
+	if auditLog.Route != nil && auditLog.Route.Topic != "" {
+		return auditLog.Route.Topic
+	}
+	return AUDIT_TOPIC
+}
+
+// 获取审计日志的分区 key, 未设置时使用操作者ID, 同一操作者的审计日志写入同一分区
+// 系统和匿名事件没有操作者ID, 返回空字符串, sink 不设置消息的 key
+func routeKey(auditLog *AuditLog) string {
+	if auditLog.Route != nil && auditLog.Route.Key != "" {
+		return auditLog.Route.Key
+	}
+	return auditLog.Operator.ID
+}
+
+func routeHeaders(auditLog *AuditLog) map[string]string {
+	if auditLog.Route == nil {
+		return nil
+	}
+	return auditLog.Route.Headers
+}
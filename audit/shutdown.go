@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+)
+
+var (
+	ErrAuditClosed = errors.New("audit is shutting down, no longer accepting audit logs")
+)
+
+// 停止审计日志处理
+// 不再接收新的审计日志, 排空队列并在 ctx 结束前尽量发送完毕, 然后关闭 sink
+// 返回未发送成功的审计日志条数; 开启落盘缓冲时, 未发送的审计日志保留在段文件中, 下次启动后重放
+func Shutdown(ctx context.Context) (int, error) {
+	return defaultClient.Shutdown(ctx)
+}
+
+// 停止审计日志处理, 与 Shutdown 相同
+func (c *Client) Shutdown(ctx context.Context) (int, error) {
+	if !c.started.Load() {
+		return 0, nil
+	}
+
+	// 阻塞等待队列的 enqueue 持有读锁, 先通知其返回, 否则队列一直满时无法获取写锁
+	c.closingOnce.Do(func() { close(c.closingCh) })
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, ErrAuditClosed
+	}
+	close(c.stopCh)
+	c.closed = true
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		c.cancel()
+		<-done
+	}
+	c.cancel()
+
+	if closeErr := c.sink.Close(); closeErr != nil {
+		logger.Errorf("close audit sink failed: %v", closeErr)
+		err = errors.Join(err, closeErr)
+	}
+
+	undelivered := int(c.undelivered.Load())
+	if c.spool != nil {
+		undelivered = int(c.spool.stats().Depth)
+		if closeErr := c.spool.close(); closeErr != nil {
+			logger.Errorf("close audit spool failed: %v", closeErr)
+			err = errors.Join(err, closeErr)
+		}
+		if undelivered > 0 {
+			logger.Warnf("audit shutdown, %d audit logs remain in spool and will be replayed after restart", undelivered)
+		}
+	} else if undelivered > 0 {
+		logger.Errorf("audit shutdown, %d audit logs are not delivered", undelivered)
+	}
+
+	return undelivered, err
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 第一条审计日志发送成功, 之后的一直发送失败
+type flakySink struct {
+	mu   sync.Mutex
+	sent []*AuditLog
+}
+
+func (s *flakySink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sent) > 0 {
+		return &DeliveryError{Failed: auditLogs, Err: context.DeadlineExceeded}
+	}
+	s.sent = append(s.sent, auditLogs...)
+	return nil
+}
+
+func (s *flakySink) Close() error {
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("test shutdown\n", t, func() {
+		sink := &flakySink{}
+		c, err := NewClient(sink)
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 3; i++ {
+			So(c.NewInfoLog(context.Background(), OPERATION, CREATE, AuditOperator{}, AuditObject{}, ""), ShouldBeNil)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		undelivered, err := c.Shutdown(ctx)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		So(undelivered, ShouldEqual, 2)
+		So(len(sink.sent), ShouldEqual, 1)
+
+		err = c.NewInfoLog(context.Background(), OPERATION, CREATE, AuditOperator{}, AuditObject{}, "")
+		So(err, ShouldEqual, ErrAuditClosed)
+	})
+
+	Convey("test shutdown while enqueue is blocked on a full queue\n", t, func() {
+		c := newClient()
+		c.logChan = make(chan *AuditLog, 1)
+		So(c.start(&flakySink{}), ShouldBeNil)
+
+		// 第一条发送成功, 第二条一直重试, 第三条占满队列
+		for i := 0; i < 3; i++ {
+			So(c.NewInfoLog(context.Background(), OPERATION, CREATE, AuditOperator{}, AuditObject{}, ""), ShouldBeNil)
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		blocked := make(chan error, 1)
+		go func() {
+			blocked <- c.NewInfoLog(context.Background(), OPERATION, CREATE, AuditOperator{}, AuditObject{}, "")
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := c.Shutdown(ctx)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+		So(<-blocked, ShouldEqual, ErrAuditClosed)
+	})
+}
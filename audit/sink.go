@@ -0,0 +1,179 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AuditSink 审计日志输出接口
+// Send 返回错误时, 同一批审计日志会被重新发送, 实现需能容忍重复 (可按 out_biz_id 去重)
+// 返回 DeliveryError 时只重新发送其中的审计日志, 需包括发送失败的审计日志及其后所有相同分区 key 的审计日志, 以保证 key 内有序
+type AuditSink interface {
+	Send(ctx context.Context, auditLogs []*AuditLog) error
+	Close() error
+}
+
+// 组合多个 sink, 一条审计日志同时输出到所有 sink
+// 每个 sink 分别记录已发送的审计日志, 重新发送时只发送给失败的 sink, 已成功的 sink 不会重复收到
+// 失败的 sink 恢复之前, 之后的审计日志等待重试, 需要各 sink 互不影响时为每个 sink 创建 Client
+type multiSink struct {
+	sinks []AuditSink
+
+	mu sync.Mutex
+	// 审计日志已发送成功的 sink, 所有 sink 都发送成功后删除
+	delivered map[*AuditLog][]bool
+}
+
+func NewMultiSink(sinks ...AuditSink) AuditSink {
+	return &multiSink{
+		sinks:     sinks,
+		delivered: map[*AuditLog][]bool{},
+	}
+}
+
+// 返回的 DeliveryError 中为至少一个 sink 发送失败的审计日志
+func (s *multiSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, auditLog := range auditLogs {
+		if _, ok := s.delivered[auditLog]; !ok {
+			s.delivered[auditLog] = make([]bool, len(s.sinks))
+		}
+	}
+
+	var errs []error
+	failed := map[*AuditLog]bool{}
+	for i, sink := range s.sinks {
+		pending := make([]*AuditLog, 0, len(auditLogs))
+		for _, auditLog := range auditLogs {
+			if !s.delivered[auditLog][i] {
+				pending = append(pending, auditLog)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		err := sink.Send(ctx, pending)
+		sinkFailed := map[*AuditLog]bool{}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("audit sink %d: %w", i, err))
+			var deliveryErr *DeliveryError
+			if errors.As(err, &deliveryErr) && len(deliveryErr.Failed) > 0 {
+				for _, auditLog := range deliveryErr.Failed {
+					sinkFailed[auditLog] = true
+				}
+			} else {
+				for _, auditLog := range pending {
+					sinkFailed[auditLog] = true
+				}
+			}
+		}
+		for _, auditLog := range pending {
+			if sinkFailed[auditLog] {
+				failed[auditLog] = true
+			} else {
+				s.delivered[auditLog][i] = true
+			}
+		}
+	}
+
+	var retry []*AuditLog
+	for _, auditLog := range auditLogs {
+		if failed[auditLog] {
+			retry = append(retry, auditLog)
+		} else {
+			delete(s.delivered, auditLog)
+		}
+	}
+	if len(retry) == 0 {
+		return nil
+	}
+	return &DeliveryError{Failed: retry, Err: errors.Join(errs...)}
+}
+
+func (s *multiSink) Close() error {
+	var errs []error
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 按 JSON Lines 格式输出审计日志
+type writerSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+// 输出到标准输出, 用于本地开发
+func NewStdoutSink() AuditSink {
+	return &writerSink{
+		writer: os.Stdout,
+	}
+}
+
+// 审计日志文件配置项
+// FileName: 文件路径
+// MaxSize: 单个文件最大长度, 单位是M
+// MaxAge: 文件保留的最长时间, 单位为天
+// MaxBackups: 旧文件保留的最大个数
+type FileSinkSetting struct {
+	FileName   string `json:"fileName"   mapstructure:"fileName"`
+	MaxSize    int    `json:"maxSize"    mapstructure:"maxSize"`
+	MaxAge     int    `json:"maxAge"     mapstructure:"maxAge"`
+	MaxBackups int    `json:"maxBackups" mapstructure:"maxBackups"`
+}
+
+// 输出到按大小轮转的 JSON Lines 文件
+func NewFileSink(setting FileSinkSetting) AuditSink {
+	hook := &lumberjack.Logger{
+		Filename:   setting.FileName,
+		LocalTime:  true,
+		MaxAge:     setting.MaxAge,
+		MaxBackups: setting.MaxBackups,
+		MaxSize:    setting.MaxSize,
+	}
+	return &writerSink{
+		writer: hook,
+		closer: hook,
+	}
+}
+
+func (s *writerSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	var buf []byte
+	for _, auditLog := range auditLogs {
+		line, err := sonic.Marshal(auditLog)
+		if err != nil {
+			return fmt.Errorf("marshal auditLog failed: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.writer.Write(buf); err != nil {
+		return fmt.Errorf("write auditLog failed: %w", err)
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
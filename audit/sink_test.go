@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type failedSink struct{}
+
+func (s failedSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	return errors.New("sink unavailable")
+}
+
+func (s failedSink) Close() error {
+	return nil
+}
+
+// 记录收到的审计日志, fail 不为空时其中的审计日志发送失败
+type recordSink struct {
+	received []string
+	fail     map[string]bool
+}
+
+func (s *recordSink) Send(ctx context.Context, auditLogs []*AuditLog) error {
+	var failed []*AuditLog
+	for _, auditLog := range auditLogs {
+		if s.fail[auditLog.ID] {
+			failed = append(failed, auditLog)
+			continue
+		}
+		s.received = append(s.received, auditLog.ID)
+	}
+	if len(failed) > 0 {
+		return &DeliveryError{Failed: failed, Err: errors.New("partial failure")}
+	}
+	return nil
+}
+
+func (s *recordSink) Close() error {
+	return nil
+}
+
+func TestSink(t *testing.T) {
+	Convey("test audit sink\n", t, func() {
+		fileName := filepath.Join(t.TempDir(), "audit.log")
+		fileSink := NewFileSink(FileSinkSetting{FileName: fileName})
+		auditLogs := []*AuditLog{{ID: "1"}, {ID: "2"}}
+
+		Convey("file sink writes json lines\n", func() {
+			So(fileSink.Send(context.Background(), auditLogs), ShouldBeNil)
+			So(fileSink.Close(), ShouldBeNil)
+
+			buf, err := os.ReadFile(fileName)
+			So(err, ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+			So(len(lines), ShouldEqual, 2)
+			So(lines[0], ShouldContainSubstring, `"out_biz_id":"1"`)
+		})
+
+		Convey("multi sink fans out and joins errors\n", func() {
+			sink := NewMultiSink(fileSink, failedSink{})
+			err := sink.Send(context.Background(), auditLogs)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "sink unavailable")
+
+			// 重试时已成功的 sink 不会重复收到
+			var deliveryErr *DeliveryError
+			So(errors.As(err, &deliveryErr), ShouldBeTrue)
+			So(deliveryErr.Failed, ShouldResemble, auditLogs)
+			So(sink.Send(context.Background(), deliveryErr.Failed), ShouldNotBeNil)
+			So(sink.Close(), ShouldBeNil)
+
+			buf, err := os.ReadFile(fileName)
+			So(err, ShouldBeNil)
+			So(strings.Count(string(buf), "\n"), ShouldEqual, 2)
+		})
+
+		Convey("multi sink retries only the failed sink and audit logs\n", func() {
+			healthy := &recordSink{}
+			partial := &recordSink{fail: map[string]bool{"2": true}}
+			sink := NewMultiSink(healthy, partial)
+
+			err := sink.Send(context.Background(), auditLogs)
+			var deliveryErr *DeliveryError
+			So(errors.As(err, &deliveryErr), ShouldBeTrue)
+			So(deliveryErr.Failed, ShouldResemble, auditLogs[1:])
+
+			partial.fail = nil
+			So(sink.Send(context.Background(), deliveryErr.Failed), ShouldBeNil)
+			So(healthy.received, ShouldResemble, []string{"1", "2"})
+			So(partial.received, ShouldResemble, []string{"1", "2"})
+			So(sink.(*multiSink).delivered, ShouldBeEmpty)
+		})
+	})
+}
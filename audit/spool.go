@@ -0,0 +1,538 @@
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+)
+
+const (
+	DEFAULT_SPOOL_SEGMENT_SIZE int64 = 64 * 1024 * 1024 // 单个段文件默认最大 64M
+
+	spoolSegmentPrefix  = "audit-"
+	spoolSegmentSuffix  = ".seg"
+	spoolCheckpointFile = "checkpoint"
+
+	// 记录头: 4字节长度 + 4字节crc32 + 8字节写入时间
+	spoolRecordHeaderSize = 16
+)
+
+var (
+	errSpoolEmpty = errors.New("audit spool is empty")
+)
+
+// 审计日志落盘缓冲配置项
+// Dir: 段文件所在目录, 需挂载持久化存储, 保证 pod 重启后数据仍在
+// SegmentSize: 单个段文件的最大字节数, 超过后切换到新的段文件
+type SpoolSetting struct {
+	Dir         string `json:"dir"         mapstructure:"dir"`
+	SegmentSize int64  `json:"segmentSize" mapstructure:"segmentSize"`
+}
+
+// 落盘缓冲的统计信息
+// Depth: 尚未发送成功的审计日志条数
+// Age: 最早一条未发送成功的审计日志在缓冲中停留的时间
+type SpoolStats struct {
+	Depth int64
+	Age   time.Duration
+}
+
+// 审计日志预写缓冲
+// 审计日志先按顺序追加写入段文件并 fsync, 发送成功后再推进 checkpoint,
+// 保证 kafka 不可用或 pod 重启时审计日志不丢失, 恢复后按写入顺序重放
+type spool struct {
+	mu     sync.Mutex
+	dir    string
+	segMax int64
+
+	writeSeq  uint64
+	writeFile *os.File
+	writeSize int64
+
+	readSeq  uint64
+	readOff  int64
+	readFile *os.File
+
+	depth    int64
+	headTime int64 // 队首记录的写入时间, unix nano
+
+	notify chan struct{}
+}
+
+// 打开落盘缓冲, 恢复 checkpoint 并统计未发送的记录
+func openSpool(setting SpoolSetting) (*spool, error) {
+	if setting.Dir == "" {
+		return nil, errors.New("audit spool dir is empty")
+	}
+	if setting.SegmentSize <= 0 {
+		setting.SegmentSize = DEFAULT_SPOOL_SEGMENT_SIZE
+	}
+
+	if err := os.MkdirAll(setting.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create audit spool dir %s failed: %w", setting.Dir, err)
+	}
+
+	s := &spool{
+		dir:    setting.Dir,
+		segMax: setting.SegmentSize,
+		notify: make(chan struct{}, 1),
+	}
+
+	seqs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) == 0 {
+		seqs = []uint64{1}
+	}
+
+	s.readSeq, s.readOff, err = s.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	// checkpoint 不存在或者指向的段文件已被删除, 从最早的段文件开始读
+	if s.readSeq < seqs[0] {
+		s.readSeq, s.readOff = seqs[0], 0
+	}
+
+	// 逐个扫描段文件, 统计未发送的记录数, 截断最后一个段文件中写了一半的记录
+	for i, seq := range seqs {
+		if seq < s.readSeq {
+			continue
+		}
+		offset := int64(0)
+		if seq == s.readSeq {
+			offset = s.readOff
+		}
+		count, validSize, err := s.scanSegment(seq, offset)
+		if err != nil {
+			return nil, err
+		}
+		s.depth += count
+
+		if i == len(seqs)-1 {
+			s.writeSeq = seq
+			s.writeSize = validSize
+		}
+	}
+
+	s.writeFile, err = os.OpenFile(s.segmentPath(s.writeSeq), os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("open audit spool segment failed: %w", err)
+	}
+	if err = s.writeFile.Truncate(s.writeSize); err != nil {
+		return nil, fmt.Errorf("truncate audit spool segment failed: %w", err)
+	}
+	if _, err = s.writeFile.Seek(s.writeSize, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek audit spool segment failed: %w", err)
+	}
+
+	s.refreshHeadTime()
+
+	logger.Infof("open audit spool %s, pending audit logs: %d", s.dir, s.depth)
+	return s, nil
+}
+
+// 落盘记录, 在审计日志之外保存投递信息
+type spoolEntry struct {
+	*AuditLog
+	Route *AuditRoute `json:"__route,omitempty"`
+}
+
+// 追加一条审计日志, 写入并 fsync 成功后返回
+func (s *spool) append(auditLog *AuditLog) error {
+	payload, err := sonic.Marshal(spoolEntry{AuditLog: auditLog, Route: auditLog.Route})
+	if err != nil {
+		return fmt.Errorf("marshal auditLog failed: %w", err)
+	}
+
+	now := time.Now().UnixNano()
+	record := make([]byte, spoolRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint64(record[8:16], uint64(now))
+	copy(record[spoolRecordHeaderSize:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writeSize > 0 && s.writeSize+int64(len(record)) > s.segMax {
+		if err = s.rollSegment(); err != nil {
+			return err
+		}
+	}
+
+	if _, err = s.writeFile.Write(record); err != nil {
+		return fmt.Errorf("write audit spool segment failed: %w", err)
+	}
+	if err = s.writeFile.Sync(); err != nil {
+		return fmt.Errorf("sync audit spool segment failed: %w", err)
+	}
+	s.writeSize += int64(len(record))
+
+	if s.depth == 0 {
+		s.headTime = now
+	}
+	s.depth++
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// 阻塞获取队首的审计日志, 最多 max 条, 直到有数据或 ctx 结束
+// 一次只返回同一个段文件中的记录
+func (s *spool) peek(ctx context.Context, max int) ([]*AuditLog, error) {
+	for {
+		auditLogs, err := s.tryPeek(max)
+		if !errors.Is(err, errSpoolEmpty) {
+			return auditLogs, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.notify:
+		}
+	}
+}
+
+func (s *spool) tryPeek(max int) ([]*AuditLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.depth == 0 {
+			return nil, errSpoolEmpty
+		}
+
+		auditLogs := []*AuditLog{}
+		offset := s.readOff
+		for len(auditLogs) < max && int64(len(auditLogs)) < s.depth {
+			payload, size, err := s.readRecord(offset)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				if len(auditLogs) > 0 {
+					break
+				}
+				return nil, err
+			}
+
+			entry := spoolEntry{AuditLog: &AuditLog{}}
+			if err = sonic.Unmarshal(payload, &entry); err != nil {
+				return nil, fmt.Errorf("unmarshal audit spool record failed: %w", err)
+			}
+			entry.AuditLog.Route = entry.Route
+			auditLogs = append(auditLogs, entry.AuditLog)
+			offset += size
+		}
+		if len(auditLogs) > 0 {
+			return auditLogs, nil
+		}
+
+		// 当前段文件已读完, 切换到下一个段文件
+		if s.readSeq >= s.writeSeq {
+			return nil, errSpoolEmpty
+		}
+		if err := s.advanceSegment(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 确认队首的 n 条审计日志已发送成功, 推进 checkpoint
+func (s *spool) ack(n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		_, size, err := s.readRecord(s.readOff)
+		if err != nil {
+			return err
+		}
+		s.readOff += size
+		s.depth--
+	}
+
+	if err := s.saveCheckpoint(); err != nil {
+		return err
+	}
+
+	s.refreshHeadTime()
+	return nil
+}
+
+// 获取统计信息
+func (s *spool) stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SpoolStats{Depth: s.depth}
+	if s.depth > 0 && s.headTime > 0 {
+		stats.Age = time.Since(time.Unix(0, s.headTime))
+	}
+	return stats
+}
+
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readFile != nil {
+		_ = s.readFile.Close()
+		s.readFile = nil
+	}
+	return s.writeFile.Close()
+}
+
+// 读取当前段文件中 offset 处的记录, 返回记录内容和记录总长度
+func (s *spool) readRecord(offset int64) ([]byte, int64, error) {
+	if s.readFile == nil {
+		f, err := os.Open(s.segmentPath(s.readSeq))
+		if err != nil {
+			return nil, 0, fmt.Errorf("open audit spool segment failed: %w", err)
+		}
+		s.readFile = f
+	}
+
+	header := make([]byte, spoolRecordHeaderSize)
+	if _, err := s.readFile.ReadAt(header, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("read audit spool segment failed: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	payload := make([]byte, length)
+	if _, err := s.readFile.ReadAt(payload, offset+spoolRecordHeaderSize); err != nil {
+		return nil, 0, fmt.Errorf("read audit spool segment failed: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, fmt.Errorf("audit spool segment %d is corrupted at offset %d", s.readSeq, offset)
+	}
+
+	return payload, spoolRecordHeaderSize + int64(length), nil
+}
+
+// 读取队首记录的写入时间
+func (s *spool) refreshHeadTime() {
+	s.headTime = 0
+	if s.depth == 0 {
+		return
+	}
+
+	for {
+		if s.readFile == nil {
+			f, err := os.Open(s.segmentPath(s.readSeq))
+			if err != nil {
+				return
+			}
+			s.readFile = f
+		}
+
+		header := make([]byte, spoolRecordHeaderSize)
+		if _, err := s.readFile.ReadAt(header, s.readOff); err == nil {
+			s.headTime = int64(binary.BigEndian.Uint64(header[8:16]))
+			return
+		}
+		if s.readSeq >= s.writeSeq || s.advanceSegment() != nil {
+			return
+		}
+	}
+}
+
+// 读位置切换到下一个段文件, 并删除已读完的段文件
+func (s *spool) advanceSegment() error {
+	if s.readFile != nil {
+		_ = s.readFile.Close()
+		s.readFile = nil
+	}
+
+	oldSeq := s.readSeq
+	s.readSeq, s.readOff = oldSeq+1, 0
+	if err := s.saveCheckpoint(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.segmentPath(oldSeq)); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("remove audit spool segment %d failed: %v", oldSeq, err)
+	}
+	return nil
+}
+
+// 写位置切换到新的段文件
+func (s *spool) rollSegment() error {
+	if err := s.writeFile.Close(); err != nil {
+		return fmt.Errorf("close audit spool segment failed: %w", err)
+	}
+
+	f, err := os.OpenFile(s.segmentPath(s.writeSeq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("create audit spool segment failed: %w", err)
+	}
+
+	s.writeSeq++
+	s.writeFile = f
+	s.writeSize = 0
+	return nil
+}
+
+// 扫描段文件, 返回 offset 之后的有效记录数和段文件的有效长度
+func (s *spool) scanSegment(seq uint64, offset int64) (int64, int64, error) {
+	f, err := os.Open(s.segmentPath(seq))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("open audit spool segment failed: %w", err)
+	}
+	defer f.Close()
+
+	var count int64
+	pos := int64(0)
+	header := make([]byte, spoolRecordHeaderSize)
+	for {
+		if _, err = f.ReadAt(header, pos); err != nil {
+			break
+		}
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		payload := make([]byte, length)
+		if _, err = f.ReadAt(payload, pos+spoolRecordHeaderSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			break
+		}
+
+		if pos >= offset {
+			count++
+		}
+		pos += spoolRecordHeaderSize + length
+	}
+
+	return count, pos, nil
+}
+
+// 获取目录下所有段文件的序号, 升序排列
+func (s *spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read audit spool dir %s failed: %w", s.dir, err)
+	}
+
+	seqs := []uint64{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix), spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func (s *spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, seq, spoolSegmentSuffix))
+}
+
+// checkpoint 格式为 "<段序号> <偏移量>"
+func (s *spool) loadCheckpoint() (uint64, int64, error) {
+	buf, err := os.ReadFile(filepath.Join(s.dir, spoolCheckpointFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("read audit spool checkpoint failed: %w", err)
+	}
+
+	var seq uint64
+	var offset int64
+	if _, err = fmt.Sscanf(string(buf), "%d %d", &seq, &offset); err != nil {
+		return 0, 0, fmt.Errorf("parse audit spool checkpoint failed: %w", err)
+	}
+	return seq, offset, nil
+}
+
+// 先写临时文件再 rename, 保证 checkpoint 不会写坏
+func (s *spool) saveCheckpoint() error {
+	path := filepath.Join(s.dir, spoolCheckpointFile)
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("write audit spool checkpoint failed: %w", err)
+	}
+	if _, err = fmt.Fprintf(f, "%d %d", s.readSeq, s.readOff); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write audit spool checkpoint failed: %w", err)
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("sync audit spool checkpoint failed: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("close audit spool checkpoint failed: %w", err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("rename audit spool checkpoint failed: %w", err)
+	}
+	return nil
+}
+
+// 注册落盘缓冲的 metric: 积压条数和最早一条积压记录的停留时间
+func registerSpoolMetrics(s *spool) {
+	meter := otel.GetMeterProvider().Meter("github.com/AISHU-Technology/kweaver-go-lib/audit")
+
+	depthGauge, err := meter.Int64ObservableGauge("audit.spool.depth",
+		metric.WithDescription("number of audit logs waiting in the spool"))
+	if err != nil {
+		logger.Errorf("create audit spool depth metric failed: %v", err)
+		return
+	}
+	ageGauge, err := meter.Float64ObservableGauge("audit.spool.age",
+		metric.WithDescription("age of the oldest audit log waiting in the spool"),
+		metric.WithUnit("s"))
+	if err != nil {
+		logger.Errorf("create audit spool age metric failed: %v", err)
+		return
+	}
+
+	// 多个 Client 开启落盘缓冲时, 通过目录区分
+	attrs := metric.WithAttributes(attribute.String("dir", s.dir))
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		stats := s.stats()
+		o.ObserveInt64(depthGauge, stats.Depth, attrs)
+		o.ObserveFloat64(ageGauge, stats.Age.Seconds(), attrs)
+		return nil
+	}, depthGauge, ageGauge)
+	if err != nil {
+		logger.Errorf("register audit spool metrics failed: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpool(t *testing.T) {
+	Convey("test audit spool\n", t, func() {
+		setting := SpoolSetting{
+			Dir:         t.TempDir(),
+			SegmentSize: 256,
+		}
+
+		s, err := openSpool(setting)
+		So(err, ShouldBeNil)
+		for _, id := range []string{"1", "2", "3", "4", "5"} {
+			err = s.append(&AuditLog{ID: id, Detail: map[string]string{}})
+			So(err, ShouldBeNil)
+		}
+		So(s.stats().Depth, ShouldEqual, 5)
+
+		Convey("replay in order after reopen\n", func() {
+			auditLogs, err := s.peek(context.Background(), 1)
+			So(err, ShouldBeNil)
+			So(auditLogs[0].ID, ShouldEqual, "1")
+			So(s.ack(len(auditLogs)), ShouldBeNil)
+
+			auditLogs, err = s.peek(context.Background(), 1)
+			So(err, ShouldBeNil)
+			So(auditLogs[0].ID, ShouldEqual, "2")
+			So(s.ack(len(auditLogs)), ShouldBeNil)
+			So(s.close(), ShouldBeNil)
+
+			s, err = openSpool(setting)
+			So(err, ShouldBeNil)
+			So(s.stats().Depth, ShouldEqual, 3)
+
+			for _, id := range []string{"3", "4", "5"} {
+				auditLogs, err = s.peek(context.Background(), 1)
+				So(err, ShouldBeNil)
+				So(auditLogs[0].ID, ShouldEqual, id)
+				So(s.ack(len(auditLogs)), ShouldBeNil)
+			}
+			So(s.stats().Depth, ShouldEqual, 0)
+			So(s.stats().Age, ShouldEqual, 0)
+		})
+
+		Convey("peek returns when context is done\n", func() {
+			for i := 0; i < 5; i++ {
+				auditLogs, err := s.peek(context.Background(), 10)
+				So(err, ShouldBeNil)
+				So(s.ack(len(auditLogs)), ShouldBeNil)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = s.peek(ctx, 10)
+			So(err, ShouldEqual, context.Canceled)
+		})
+	})
+
+	Convey("test audit spool batch peek\n", t, func() {
+		s, err := openSpool(SpoolSetting{Dir: t.TempDir()})
+		So(err, ShouldBeNil)
+		for _, id := range []string{"1", "2", "3"} {
+			So(s.append(&AuditLog{ID: id, Detail: map[string]string{}}), ShouldBeNil)
+		}
+
+		auditLogs, err := s.peek(context.Background(), 2)
+		So(err, ShouldBeNil)
+		So(len(auditLogs), ShouldEqual, 2)
+		So(auditLogs[1].ID, ShouldEqual, "2")
+		So(s.ack(len(auditLogs)), ShouldBeNil)
+
+		auditLogs, err = s.peek(context.Background(), 2)
+		So(err, ShouldBeNil)
+		So(len(auditLogs), ShouldEqual, 1)
+		So(auditLogs[0].ID, ShouldEqual, "3")
+	})
+}
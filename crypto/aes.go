@@ -1,24 +1,66 @@
 package crypto
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"strings"
-
-	"github.com/AISHU-Technology/kweaver-go-lib/logger"
 )
 
 const (
 	DEFAULT_CIPHER_MODE = "ECB"
+
+	// AES 加密模式
+	AES_MODE_ECB = "ECB"
+	AES_MODE_CBC = "CBC"
+	AES_MODE_GCM = "GCM"
+
+	AES_256_KEY_SIZE = 32
+
+	// GCM 密文格式的版本, 密文为 base64(版本 + nonce + 密文 + tag)
+	AES_GCM_VERSION byte = 0x01
+)
+
+var (
+	ErrInvalidCiphertext = errors.New("crypto: invalid ciphertext")
+	ErrInvalidPadding    = errors.New("crypto: invalid padding")
 )
 
 type aesCipher struct {
 	key        string
 	cipherMode string
+
+	// GCM 模式
+	aead cipher.AEAD
+	aad  []byte
+}
+
+// AES-GCM 的可选配置
+type AESOption func(ci *aesCipher)
+
+// 设置默认的附加数据, Encrypt 和 Decrypt 使用
+func WithAAD(aad []byte) AESOption {
+	return func(ci *aesCipher) {
+		ci.aad = aad
+	}
+}
+
+// 设置 DecryptLegacy 使用的 ECB 密钥, 默认使用 GCM 密钥
+func WithLegacyECBKey(key string) AESOption {
+	return func(ci *aesCipher) {
+		ci.key = key
+	}
 }
 
 func NewAESCipher(key string) Cipher {
+	return NewCipherAdapter(NewAESCipherV2(key))
+}
+
+func NewAESCipherV2(key string) CipherV2 {
 	ci := &aesCipher{
 		key:        key,
 		cipherMode: DEFAULT_CIPHER_MODE,
@@ -26,36 +68,130 @@ func NewAESCipher(key string) Cipher {
 	return ci
 }
 
-func (ci aesCipher) Decrypt(encryptedData string) string {
+// 创建 AES-256-GCM 加解密, 每次加密使用随机 nonce, key 为 32 字节
+// Decrypt 只接受有版本的密文, 旧的 ECB 密文使用 DecryptLegacy 解密, 由调用方区分 (例如迁移时为新密文添加前缀)
+func NewAESGCMCipher(key []byte, opts ...AESOption) (AEADCipher, error) {
+	if len(key) != AES_256_KEY_SIZE {
+		return nil, fmt.Errorf("invalid AES-256 key size %d, expected %d", len(key), AES_256_KEY_SIZE)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create AES cipher failed: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create AES-GCM failed: %w", err)
+	}
+
+	ci := &aesCipher{
+		key:        string(key),
+		cipherMode: AES_MODE_GCM,
+		aead:       aead,
+	}
+	for _, opt := range opts {
+		opt(ci)
+	}
+	return ci, nil
+}
+
+func (ci aesCipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
 	switch ci.cipherMode {
-	case "CBC":
+	case AES_MODE_GCM:
+		return ci.decryptGCM(encryptedData, ci.aad)
+	case AES_MODE_CBC:
 		return ci.decryptCBC(encryptedData)
-	case "ECB":
+	case AES_MODE_ECB:
 		return ci.decryptECB(encryptedData)
 	default:
-		logger.Fatalf("Invalid AES Cipher Mode: %s", ci.cipherMode)
-		return ""
+		return "", fmt.Errorf("invalid AES cipher mode: %s", ci.cipherMode)
 	}
 }
 
-func (ci aesCipher) Encrypt(encryptedData string) string {
+func (ci aesCipher) Encrypt(ctx context.Context, data string) (string, error) {
 	switch ci.cipherMode {
-	case "ECB":
-		return ci.encryptECB(encryptedData)
+	case AES_MODE_GCM:
+		return ci.encryptGCM(data, ci.aad)
+	case AES_MODE_ECB:
+		return ci.encryptECB(data)
 	default:
-		logger.Fatalf("Invalid AES Cipher Mode: %s", ci.cipherMode)
-		return ""
+		return "", fmt.Errorf("invalid AES cipher mode: %s", ci.cipherMode)
+	}
+}
+
+func (ci aesCipher) EncryptWithAAD(ctx context.Context, data string, aad []byte) (string, error) {
+	if ci.aead == nil {
+		return "", fmt.Errorf("AES cipher mode %s does not support associated data", ci.cipherMode)
+	}
+	return ci.encryptGCM(data, aad)
+}
+
+func (ci aesCipher) DecryptWithAAD(ctx context.Context, encryptedData string, aad []byte) (string, error) {
+	if ci.aead == nil {
+		return "", fmt.Errorf("AES cipher mode %s does not support associated data", ci.cipherMode)
+	}
+	return ci.decryptGCM(encryptedData, aad)
+}
+
+// 按 ECB 方式解密旧的密文, 密钥由 WithLegacyECBKey 设置
+func (ci aesCipher) DecryptLegacy(ctx context.Context, encryptedData string) (string, error) {
+	return ci.decryptECB(encryptedData)
+}
+
+// GCM方式加密, 版本参与认证
+func (ci aesCipher) encryptGCM(data string, aad []byte) (string, error) {
+	nonce := make([]byte, ci.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate AES-GCM nonce failed: %w", err)
+	}
+
+	encrypted := make([]byte, 0, 1+len(nonce)+len(data)+ci.aead.Overhead())
+	encrypted = append(encrypted, AES_GCM_VERSION)
+	encrypted = append(encrypted, nonce...)
+	encrypted = ci.aead.Seal(encrypted, nonce, []byte(data), gcmAdditionalData(aad))
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// GCM方式解密, 版本不匹配或认证失败时返回错误
+func (ci aesCipher) decryptGCM(encryptedData string, aad []byte) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode AES ciphertext failed: %w", err)
+	}
+
+	nonceSize := ci.aead.NonceSize()
+	if len(encrypted) < 1+nonceSize+ci.aead.Overhead() || encrypted[0] != AES_GCM_VERSION {
+		return "", ErrInvalidCiphertext
+	}
+	nonce := encrypted[1 : 1+nonceSize]
+	decrypted, err := ci.aead.Open(nil, nonce, encrypted[1+nonceSize:], gcmAdditionalData(aad))
+	if err != nil {
+		return "", fmt.Errorf("AES-GCM authentication failed: %w", err)
 	}
+	return string(decrypted), nil
+}
+
+func gcmAdditionalData(aad []byte) []byte {
+	return append([]byte{AES_GCM_VERSION}, aad...)
 }
 
 // CBC方式解密
-func (ci aesCipher) decryptCBC(encryptedData string) string {
-	encrypted, _ := base64.StdEncoding.DecodeString(encryptedData)
+func (ci aesCipher) decryptCBC(encryptedData string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode AES ciphertext failed: %w", err)
+	}
 	key := []byte(ci.key)
 	// 创建实例
-	block, _ := aes.NewCipher(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", fmt.Errorf("create AES cipher failed: %w", err)
+	}
 	//获取块的大小
 	blockSize := block.BlockSize()
+	if len(encrypted) == 0 || len(encrypted)%blockSize != 0 {
+		return "", ErrInvalidCiphertext
+	}
 	//使用cbc
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	//初始化揭秘数据接收切片
@@ -63,24 +199,33 @@ func (ci aesCipher) decryptCBC(encryptedData string) string {
 	//执行解密
 	blockMode.CryptBlocks(decrypted, encrypted)
 	//去除填充
-	decryptedData := ci.pkcs5UnPadding(decrypted)
-	return string(decryptedData)
+	decryptedData, err := ci.pkcs5UnPadding(decrypted)
+	if err != nil {
+		return "", err
+	}
+	return string(decryptedData), nil
 }
 
 // pkcs5方式解除填充
-func (ci aesCipher) pkcs5UnPadding(decryptedData []byte) []byte {
+func (ci aesCipher) pkcs5UnPadding(decryptedData []byte) ([]byte, error) {
 	length := len(decryptedData)
 	unpadding := int(decryptedData[length-1])
-	return decryptedData[:(length - unpadding)]
+	if unpadding == 0 || unpadding > length {
+		return nil, ErrInvalidPadding
+	}
+	return decryptedData[:(length - unpadding)], nil
 }
 
 // ECB方式加密
-func (ci aesCipher) encryptECB(data string) string {
+func (ci aesCipher) encryptECB(data string) (string, error) {
 
 	cipherText := []byte(data)
 	key := []byte(ci.key)
 	//创建实例
-	block, _ := aes.NewCipher(ci.generateKey(key))
+	block, err := aes.NewCipher(ci.generateKey(key))
+	if err != nil {
+		return "", fmt.Errorf("create AES cipher failed: %w", err)
+	}
 	//获取块的大小
 	blockSize := block.BlockSize()
 
@@ -95,17 +240,26 @@ func (ci aesCipher) encryptECB(data string) string {
 	}
 
 	b := base64.StdEncoding.EncodeToString(encrypted)
-	return b
+	return b, nil
 }
 
 // ECB方式解密
-func (ci aesCipher) decryptECB(encryptedData string) string {
-	encrypted, _ := base64.StdEncoding.DecodeString(encryptedData)
+func (ci aesCipher) decryptECB(encryptedData string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode AES ciphertext failed: %w", err)
+	}
 	key := []byte(ci.key)
 	// 创建实例
-	block, _ := aes.NewCipher(ci.generateKey(key))
+	block, err := aes.NewCipher(ci.generateKey(key))
+	if err != nil {
+		return "", fmt.Errorf("create AES cipher failed: %w", err)
+	}
 	//获取块的大小
 	blockSize := block.BlockSize()
+	if len(encrypted)%blockSize != 0 {
+		return "", ErrInvalidCiphertext
+	}
 	//初始化揭秘数据接收切片
 	decrypted := make([]byte, len(encrypted))
 	//分组分块解密
@@ -117,9 +271,12 @@ func (ci aesCipher) decryptECB(encryptedData string) string {
 	if len(decrypted) > 0 {
 		trim = len(decrypted) - int(decrypted[len(decrypted)-1])
 	}
+	if trim < 0 {
+		return "", ErrInvalidPadding
+	}
 
 	decryptedData := strings.TrimRight(string(decrypted[:trim]), "\x00")
-	return decryptedData
+	return decryptedData, nil
 }
 
 func (ci aesCipher) generateKey(key []byte) (genKey []byte) {
@@ -133,7 +290,6 @@ func (ci aesCipher) generateKey(key []byte) (genKey []byte) {
 	return genKey
 }
 
-func (ci aesCipher) Signature(signContent string) string {
-	logger.Fatalf("aesCipher Signature is Not implemented Yet.")
-	return ""
+func (ci aesCipher) Signature(ctx context.Context, signContent string) (string, error) {
+	return "", fmt.Errorf("aesCipher Signature: %w", ErrNotImplemented)
 }
@@ -1,6 +1,11 @@
 package crypto
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -33,3 +38,150 @@ func TestAesEncrypt(t *testing.T) {
 		})
 	})
 }
+
+func TestAesCipherV2(t *testing.T) {
+	Convey("test malformed ciphertext\n", t, func() {
+		aesCipher := NewAESCipherV2(KEY)
+		ctx := context.Background()
+
+		Convey("round trip\n", func() {
+			encrypted, err := aesCipher.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			decrypted, err := aesCipher.Decrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("invalid base64\n", func() {
+			_, err := aesCipher.Decrypt(ctx, "not base64!")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("invalid length\n", func() {
+			_, err := aesCipher.Decrypt(ctx, base64.StdEncoding.EncodeToString([]byte("short")))
+			So(err, ShouldEqual, ErrInvalidCiphertext)
+		})
+
+		Convey("signature is not implemented\n", func() {
+			_, err := aesCipher.Signature(ctx, ODATA)
+			So(errors.Is(err, ErrNotImplemented), ShouldBeTrue)
+		})
+
+		Convey("adapter returns empty string instead of exiting\n", func() {
+			So(NewCipherAdapter(aesCipher).Decrypt("not base64!"), ShouldEqual, "")
+		})
+	})
+}
+
+func TestAesGCM(t *testing.T) {
+	Convey("test AES-256-GCM\n", t, func() {
+		ctx := context.Background()
+		key := []byte("0123456789abcdef0123456789abcdef")
+		gcmCipher, err := NewAESGCMCipher(key)
+		So(err, ShouldBeNil)
+
+		Convey("round trip with random nonce\n", func() {
+			first, err := gcmCipher.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			second, err := gcmCipher.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(first, ShouldNotEqual, second)
+
+			raw, err := base64.StdEncoding.DecodeString(first)
+			So(err, ShouldBeNil)
+			So(raw[0], ShouldEqual, AES_GCM_VERSION)
+
+			decrypted, err := gcmCipher.Decrypt(ctx, first)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("associated data\n", func() {
+			encrypted, err := gcmCipher.EncryptWithAAD(ctx, ODATA, []byte("row-1"))
+			So(err, ShouldBeNil)
+
+			decrypted, err := gcmCipher.DecryptWithAAD(ctx, encrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			_, err = gcmCipher.DecryptWithAAD(ctx, encrypted, []byte("row-2"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("tampered ciphertext\n", func() {
+			encrypted, err := gcmCipher.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			raw, _ := base64.StdEncoding.DecodeString(encrypted)
+			raw[len(raw)-1] ^= 0x01
+
+			_, err = gcmCipher.Decrypt(ctx, base64.StdEncoding.EncodeToString(raw))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("every tampered byte is rejected\n", func() {
+			encrypted, err := gcmCipher.EncryptWithAAD(ctx, "0123456789abcdefghi", []byte("row-1"))
+			So(err, ShouldBeNil)
+			raw, _ := base64.StdEncoding.DecodeString(encrypted)
+
+			accepted := 0
+			for i := range raw {
+				for _, mask := range []byte{0x01, 0x80, 0xff} {
+					tampered := bytes.Clone(raw)
+					tampered[i] ^= mask
+					tamperedData := base64.StdEncoding.EncodeToString(tampered)
+					if _, err := gcmCipher.DecryptWithAAD(ctx, tamperedData, []byte("row-1")); err == nil {
+						accepted++
+					}
+				}
+			}
+			So(accepted, ShouldEqual, 0)
+
+			_, err = gcmCipher.DecryptWithAAD(ctx, encrypted, []byte("row-2"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("legacy ECB ciphertext is readable only by DecryptLegacy\n", func() {
+			ecbCipher := NewAESCipherV2(string(key))
+			legacy, ok := gcmCipher.(LegacyDecrypter)
+			So(ok, ShouldBeTrue)
+
+			encrypted, err := ecbCipher.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			_, err = gcmCipher.Decrypt(ctx, encrypted)
+			So(err, ShouldEqual, ErrInvalidCiphertext)
+			decrypted, err := legacy.DecryptLegacy(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			// 第一个字节与 GCM 版本相同的旧密文也可以读取
+			found := false
+			for i := 0; i < 4096 && !found; i++ {
+				data := fmt.Sprintf("legacy-%d", i)
+				encrypted, err := ecbCipher.Encrypt(ctx, data)
+				So(err, ShouldBeNil)
+				raw, _ := base64.StdEncoding.DecodeString(encrypted)
+				if raw[0] != AES_GCM_VERSION {
+					continue
+				}
+				found = true
+				decrypted, err := legacy.DecryptLegacy(ctx, encrypted)
+				So(err, ShouldBeNil)
+				So(decrypted, ShouldEqual, data)
+			}
+			So(found, ShouldBeTrue)
+
+			legacyCipher, err := NewAESGCMCipher(key, WithLegacyECBKey(KEY))
+			So(err, ShouldBeNil)
+			_, err = legacyCipher.Decrypt(ctx, EDATA)
+			So(err, ShouldEqual, ErrInvalidCiphertext)
+			decrypted, err = legacyCipher.(LegacyDecrypter).DecryptLegacy(ctx, EDATA)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("invalid key size\n", func() {
+			_, err := NewAESGCMCipher([]byte(KEY))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,9 +1,86 @@
 package crypto
 
+import (
+	"context"
+	"errors"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+)
+
 //go:generate mockgen -package mock -source ./cipher.go -destination ./mock/mock_cipher.go
 
+var (
+	ErrNotImplemented    = errors.New("crypto: not implemented")
+	ErrSignatureMismatch = errors.New("crypto: signature mismatch")
+)
+
+// 加解密和签名接口, 出错时记录日志并返回空字符串
+// 新代码使用 CipherV2, 以便处理错误
 type Cipher interface {
 	Decrypt(encryptedData string) string
 	Signature(signContent string) string
 	Encrypt(data string) string
 }
+
+// 返回错误的加解密和签名接口
+// 输入不合法、模式不支持或远程服务失败时返回错误, 不会退出进程
+type CipherV2 interface {
+	Decrypt(ctx context.Context, encryptedData string) (string, error)
+	Signature(ctx context.Context, signContent string) (string, error)
+	Encrypt(ctx context.Context, data string) (string, error)
+}
+
+// 支持签名校验的加解密接口, 签名不匹配时 Verify 返回 ErrSignatureMismatch
+type VerifiableCipher interface {
+	CipherV2
+	Verify(ctx context.Context, signContent string, signature string) error
+}
+
+// 支持附加数据的加解密接口
+// 附加数据不加密, 但参与认证, 解密时需提供相同的附加数据, 可用于将密文绑定到所属的记录或字段
+type AEADCipher interface {
+	CipherV2
+	EncryptWithAAD(ctx context.Context, data string, aad []byte) (string, error)
+	DecryptWithAAD(ctx context.Context, encryptedData string, aad []byte) (string, error)
+}
+
+// 支持读取旧密文的加解密接口, 旧密文没有版本, 需由调用方确定哪些值按旧的方式解密
+type LegacyDecrypter interface {
+	DecryptLegacy(ctx context.Context, encryptedData string) (string, error)
+}
+
+// 将 CipherV2 适配为 Cipher
+func NewCipherAdapter(ci CipherV2) Cipher {
+	return cipherAdapter{ci: ci}
+}
+
+type cipherAdapter struct {
+	ci CipherV2
+}
+
+func (a cipherAdapter) Decrypt(encryptedData string) string {
+	data, err := a.ci.Decrypt(context.Background(), encryptedData)
+	if err != nil {
+		logger.Errorf("cipher Decrypt failed: %v", err)
+		return ""
+	}
+	return data
+}
+
+func (a cipherAdapter) Signature(signContent string) string {
+	signature, err := a.ci.Signature(context.Background(), signContent)
+	if err != nil {
+		logger.Errorf("cipher Signature failed: %v", err)
+		return ""
+	}
+	return signature
+}
+
+func (a cipherAdapter) Encrypt(data string) string {
+	encryptedData, err := a.ci.Encrypt(context.Background(), data)
+	if err != nil {
+		logger.Errorf("cipher Encrypt failed: %v", err)
+		return ""
+	}
+	return encryptedData
+}
@@ -5,12 +5,16 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bytedance/sonic"
+	"github.com/cenkalti/backoff/v4"
 
 	"github.com/AISHU-Technology/kweaver-go-lib/logger"
 	"github.com/AISHU-Technology/kweaver-go-lib/rest"
@@ -18,99 +22,390 @@ import (
 
 const (
 	HAITAI_VERSION string = "V2.0.2"
+
+	// 密码服务 /ded-service/api 下的接口
+	// encrypt、decrypt 的请求为 {"data": ..., "dataKey": ...}, 响应的 data 为密文或明文
+	// sign 的请求为 {"data": ...}, 响应的 data 为签名; verify 的请求为 {"data": ..., "signature": ...}, 响应的 data 为是否匹配
+	HAITAI_API_ENCRYPT = "encrypt"
+	HAITAI_API_DECRYPT = "decrypt"
+	HAITAI_API_SIGN    = "sign"
+	HAITAI_API_VERIFY  = "verify"
+
+	DEFAULT_HAITAI_TIMEOUT          = 10 * time.Second
+	DEFAULT_HAITAI_MAX_ATTEMPTS     = 3
+	DEFAULT_HAITAI_INITIAL_INTERVAL = 200 * time.Millisecond
+	DEFAULT_HAITAI_MAX_INTERVAL     = 2 * time.Second
+	DEFAULT_HAITAI_CONCURRENCY      = 8
+	DEFAULT_HAITAI_CACHE_SIZE       = 1000
 )
 
+// 所有密码服务客户端共用的连接池
+var haitaiHTTPClient = rest.NewRawHTTPClientWithOptions(rest.HttpClientOptions{TimeOut: 60})
+
+// 海泰密码服务, 支持加解密、签名、验签和批量解密
+type HaitaiCipher interface {
+	VerifiableCipher
+	// 批量解密, 返回的明文与密文一一对应, 已缓存的密文不再请求密码服务
+	BatchDecrypt(ctx context.Context, encryptedData []string) ([]string, error)
+}
+
 type haitaiCipher struct {
 	key     string
 	host    string
 	realm   string
 	dataKey string
+
+	client          rest.HTTPClient
+	timeout         time.Duration
+	maxAttempts     int
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	concurrency     int
+
+	cache *decryptCache
+}
+
+// 海泰密码服务的可选配置
+type HaitaiOption func(ci *haitaiCipher)
+
+// 设置 HTTP 客户端, 默认使用共用连接池的客户端
+func WithHaitaiHTTPClient(client *http.Client) HaitaiOption {
+	return func(ci *haitaiCipher) {
+		ci.client = rest.NewHTTPClientWithRawClient(client)
+	}
+}
+
+// 设置单次请求的超时时间, 默认为 DEFAULT_HAITAI_TIMEOUT
+func WithHaitaiTimeout(timeout time.Duration) HaitaiOption {
+	return func(ci *haitaiCipher) {
+		ci.timeout = timeout
+	}
+}
+
+// 设置请求失败或返回 5xx 时的重试, 按指数退避, maxAttempts 包括第一次, 默认 3 次, 200ms 到 2s
+func WithHaitaiRetry(maxAttempts int, initialInterval time.Duration, maxInterval time.Duration) HaitaiOption {
+	return func(ci *haitaiCipher) {
+		ci.maxAttempts = maxAttempts
+		ci.initialInterval = initialInterval
+		ci.maxInterval = maxInterval
+	}
+}
+
+// 设置批量解密时并发请求的数量, 默认为 DEFAULT_HAITAI_CONCURRENCY
+func WithHaitaiConcurrency(concurrency int) HaitaiOption {
+	return func(ci *haitaiCipher) {
+		ci.concurrency = concurrency
+	}
+}
+
+// 缓存解密结果, 超过 ttl 后重新请求密码服务, size 为 0 时默认缓存 DEFAULT_HAITAI_CACHE_SIZE 个
+func WithHaitaiCache(ttl time.Duration, size int) HaitaiOption {
+	return func(ci *haitaiCipher) {
+		if size <= 0 {
+			size = DEFAULT_HAITAI_CACHE_SIZE
+		}
+		ci.cache = newDecryptCache(ttl, size)
+	}
 }
 
 func NewHaitaiCipher(key string, host string, realm string, dataKey string) Cipher {
+	return NewCipherAdapter(NewHaitaiCipherV2(key, host, realm, dataKey))
+}
+
+// 创建海泰密码服务客户端, 调用 /ded-service/api 下的接口
+// 请求失败或返回 5xx 时按指数退避重试, 返回 4xx 或 ctx 结束时不再重试
+func NewHaitaiCipherV2(key string, host string, realm string, dataKey string, opts ...HaitaiOption) HaitaiCipher {
 	ci := &haitaiCipher{
-		key:     key,
-		host:    host,
-		realm:   realm,
-		dataKey: dataKey,
+		key:             key,
+		host:            strings.TrimSuffix(host, "/"),
+		realm:           realm,
+		dataKey:         dataKey,
+		client:          rest.NewHTTPClientWithRawClient(haitaiHTTPClient),
+		timeout:         DEFAULT_HAITAI_TIMEOUT,
+		maxAttempts:     DEFAULT_HAITAI_MAX_ATTEMPTS,
+		initialInterval: DEFAULT_HAITAI_INITIAL_INTERVAL,
+		maxInterval:     DEFAULT_HAITAI_MAX_INTERVAL,
+		concurrency:     DEFAULT_HAITAI_CONCURRENCY,
+	}
+	for _, opt := range opts {
+		opt(ci)
+	}
+
+	if ci.maxAttempts < 1 {
+		ci.maxAttempts = 1
+	}
+	if ci.concurrency < 1 {
+		ci.concurrency = DEFAULT_HAITAI_CONCURRENCY
 	}
 	return ci
 }
 
 // hmac_sha256摘要k
-func (ci haitaiCipher) hmacSha256(data []byte) string {
-	key, _ := hex.DecodeString(ci.key)
+func (ci *haitaiCipher) hmacSha256(data []byte) (string, error) {
+	key, err := hex.DecodeString(ci.key)
+	if err != nil {
+		return "", fmt.Errorf("decode haitai hmac key failed: %w", err)
+	}
 	h := hmac.New(sha256.New, key)
 	h.Write(data)
-	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
 }
 
-func (ci haitaiCipher) Encrypt(encryptedData string) string {
-	logger.Fatalf("haitaiCipher Eecrypt is Not implemented Yet.")
-	return ""
+// 加密, 使用 dataKey 对应的密钥
+func (ci *haitaiCipher) Encrypt(ctx context.Context, data string) (string, error) {
+	body := map[string]interface{}{
+		"data":    data,
+		"dataKey": ci.dataKey,
+	}
+	return ci.callString(ctx, HAITAI_API_ENCRYPT, body)
 }
 
-// 解密
-func (ci haitaiCipher) Decrypt(encryptedData string) string {
-	body := map[string]string{
+// 解密, 开启缓存时优先使用缓存
+func (ci *haitaiCipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	if data, ok := ci.cache.get(encryptedData); ok {
+		return data, nil
+	}
+
+	body := map[string]interface{}{
 		"data":    encryptedData,
 		"dataKey": ci.dataKey,
 	}
-	bodyBytes, _ := sonic.Marshal(body)
-
-	httpUrl := fmt.Sprintf("%s/ded-service/api/decrypt", ci.host)
+	data, err := ci.callString(ctx, HAITAI_API_DECRYPT, body)
+	if err != nil {
+		return "", err
+	}
+	ci.cache.set(encryptedData, data)
+	return data, nil
+}
 
-	headers := map[string]string{
-		"Content-Type":  "application/json",
-		"Authorization": fmt.Sprintf("Digest algo=SHA256 realm=%s", ci.realm),
-		"hmac":          ci.hmacSha256(bodyBytes),
-		"timestamp":     strconv.FormatInt(time.Now().UnixNano()/1e6, 10),
-		"version":       HAITAI_VERSION,
+// 并发调用解密接口, 相同的密文只解密一次, 任意一个失败时取消其余的请求并返回错误
+func (ci *haitaiCipher) BatchDecrypt(ctx context.Context, encryptedData []string) ([]string, error) {
+	// 启动协程前确定需要解密的密文, 协程只写入各自下标的结果
+	index := make(map[string]int, len(encryptedData))
+	unique := make([]string, 0, len(encryptedData))
+	for _, encrypted := range encryptedData {
+		if _, ok := index[encrypted]; !ok {
+			index[encrypted] = len(unique)
+			unique = append(unique, encrypted)
+		}
 	}
+	decrypted := make([]string, len(unique))
 
-	respCode, respData, err := rest.NewHTTPClient().Post(context.Background(), httpUrl, headers, body)
-	if err != nil {
-		logger.Fatalf("get request method failed: %v", err)
-		return ""
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, ci.concurrency)
+	for i, encrypted := range unique {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, encrypted string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data, err := ci.Decrypt(ctx, encrypted)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+				return
+			}
+			decrypted[i] = data
+		}(i, encrypted)
 	}
-	if respCode != 200 {
-		logger.Fatalf("get request method failed, httpCode: %v", respCode)
-		return ""
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
 	}
 
-	resp := respData.(map[string]interface{})
-	decryptedData := resp["data"].(string)
-	return decryptedData
+	result := make([]string, len(encryptedData))
+	for i, encrypted := range encryptedData {
+		result[i] = decrypted[index[encrypted]]
+	}
+	return result, nil
 }
 
 // 签名
-func (ci haitaiCipher) Signature(signContent string) string {
-	body := map[string]string{
+func (ci *haitaiCipher) Signature(ctx context.Context, signContent string) (string, error) {
+	body := map[string]interface{}{
 		"data": signContent,
 	}
-	bodyBytes, _ := sonic.Marshal(body)
+	return ci.callString(ctx, HAITAI_API_SIGN, body)
+}
+
+// 由密码服务验签, 不匹配时返回 ErrSignatureMismatch
+func (ci *haitaiCipher) Verify(ctx context.Context, signContent string, signature string) error {
+	body := map[string]interface{}{
+		"data":      signContent,
+		"signature": signature,
+	}
+	respData, err := ci.call(ctx, HAITAI_API_VERIFY, body)
+	if err != nil {
+		return err
+	}
+	verified, ok := respData.(bool)
+	if !ok {
+		return fmt.Errorf("haitai %s response is invalid: %v", HAITAI_API_VERIFY, respData)
+	}
+	if !verified {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func (ci *haitaiCipher) callString(ctx context.Context, api string, body map[string]interface{}) (string, error) {
+	respData, err := ci.call(ctx, api, body)
+	if err != nil {
+		return "", err
+	}
+	data, ok := respData.(string)
+	if !ok {
+		return "", fmt.Errorf("haitai %s response has no data: %v", api, respData)
+	}
+	return data, nil
+}
+
+// 调用密码服务接口, 返回响应中的 data 字段, 请求失败或返回 5xx 时重试
+func (ci *haitaiCipher) call(ctx context.Context, api string, body map[string]interface{}) (interface{}, error) {
+	bodyBytes, err := sonic.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal haitai %s request failed: %w", api, err)
+	}
+	digest, err := ci.hmacSha256(bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	retryBackoff := backoff.NewExponentialBackOff()
+	retryBackoff.InitialInterval = ci.initialInterval
+	retryBackoff.MaxInterval = ci.maxInterval
+	retryBackoff.MaxElapsedTime = 0
+
+	var data interface{}
+	attempts := 0
+	err = backoff.Retry(func() error {
+		attempts++
+		var callErr error
+		data, callErr = ci.post(ctx, api, bodyBytes, digest)
+		if callErr != nil && attempts < ci.maxAttempts {
+			logger.Warnf("haitai %s request failed, retry %d: %v", api, attempts, callErr)
+		}
+		return callErr
+	}, backoff.WithContext(backoff.WithMaxRetries(retryBackoff, uint64(ci.maxAttempts-1)), ctx))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-	httpUrl := fmt.Sprintf("%s/ded-service/api/sign", ci.host)
+// 发送一次请求, 不需要重试的错误使用 backoff.Permanent 包装
+func (ci *haitaiCipher) post(ctx context.Context, api string, bodyBytes []byte, digest string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, ci.timeout)
+	defer cancel()
 
+	httpUrl := fmt.Sprintf("%s/ded-service/api/%s", ci.host, api)
 	headers := map[string]string{
 		"Content-Type":  "application/json",
 		"Authorization": fmt.Sprintf("Digest algo=SHA256 realm=%s", ci.realm),
-		"hmac":          ci.hmacSha256(bodyBytes),
+		"hmac":          digest,
 		"timestamp":     strconv.FormatInt(time.Now().UnixNano()/1e6, 10),
 		"version":       HAITAI_VERSION,
 	}
 
-	respCode, respData, err := rest.NewHTTPClient().Post(context.Background(), httpUrl, headers, body)
+	respCode, respBody, err := ci.client.PostNoUnmarshal(ctx, httpUrl, headers, bodyBytes)
 	if err != nil {
-		logger.Fatalf("get request method failed: %v", err)
-		return ""
+		if errors.Is(err, context.Canceled) {
+			return nil, backoff.Permanent(fmt.Errorf("haitai %s request failed: %w", api, err))
+		}
+		return nil, fmt.Errorf("haitai %s request failed: %w", api, err)
 	}
-	if respCode != 200 {
-		logger.Fatalf("get request method failed, httpCode: %v", respCode)
-		return ""
+	if respCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("haitai %s request failed, httpCode: %v, body: %s", api, respCode, respBody)
 	}
+	if respCode != http.StatusOK {
+		return nil, backoff.Permanent(fmt.Errorf("haitai %s request failed, httpCode: %v, body: %s", api, respCode, respBody))
+	}
+
+	var resp map[string]interface{}
+	if err := sonic.Unmarshal(respBody, &resp); err != nil {
+		return nil, backoff.Permanent(fmt.Errorf("haitai %s response is invalid: %w", api, err))
+	}
+	data, ok := resp["data"]
+	if !ok {
+		return nil, backoff.Permanent(fmt.Errorf("haitai %s response has no data: %s", api, respBody))
+	}
+	return data, nil
+}
+
+// 解密结果的缓存, 为 nil 时不缓存
+type decryptCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]decryptCacheEntry
+}
+
+type decryptCacheEntry struct {
+	data     string
+	expireAt time.Time
+}
+
+func newDecryptCache(ttl time.Duration, size int) *decryptCache {
+	return &decryptCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]decryptCacheEntry, size),
+	}
+}
 
-	resp := respData.(map[string]interface{})
-	signature := resp["data"].(string)
-	return signature
+func (c *decryptCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expireAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.data, true
+}
+
+// 缓存已满时先清理过期的结果, 仍然已满时随机淘汰一个
+func (c *decryptCache) set(key string, data string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		for k, entry := range c.entries {
+			if now.After(entry.expireAt) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = decryptCacheEntry{data: data, expireAt: now.Add(c.ttl)}
 }
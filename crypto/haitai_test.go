@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto/mock"
+)
+
+func TestHaitaiCipher(t *testing.T) {
+	Convey("test haitai cipher\n", t, func() {
+		ctx := context.Background()
+		hmacKey := "00112233445566778899aabbccddeeff"
+		server := mock.NewHaitaiServer(hmacKey)
+		defer server.Close()
+		server.AddPlaintext("dk", "encrypted", ODATA)
+		server.AddSignature(ODATA, "signed")
+
+		ci := NewHaitaiCipherV2(hmacKey, server.URL, "realm", "dk",
+			WithHaitaiRetry(3, time.Millisecond, 5*time.Millisecond),
+			WithHaitaiCache(time.Minute, 0),
+			WithHaitaiConcurrency(2))
+
+		Convey("encrypt, decrypt, sign and verify\n", func() {
+			encrypted, err := ci.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(encrypted, ShouldEqual, "encrypted")
+
+			decrypted, err := ci.Decrypt(ctx, "encrypted")
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			sign, err := ci.Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(sign, ShouldEqual, "signed")
+
+			So(ci.Verify(ctx, ODATA, "signed"), ShouldBeNil)
+			So(ci.Verify(ctx, ODATA, "forged"), ShouldEqual, ErrSignatureMismatch)
+			So(ci.Verify(ctx, "other", "signed"), ShouldEqual, ErrSignatureMismatch)
+		})
+
+		Convey("decrypted values are cached\n", func() {
+			for i := 0; i < 3; i++ {
+				decrypted, err := ci.Decrypt(ctx, "encrypted")
+				So(err, ShouldBeNil)
+				So(decrypted, ShouldEqual, ODATA)
+			}
+			So(server.Calls(HAITAI_API_DECRYPT), ShouldEqual, 1)
+		})
+
+		Convey("batch decrypt skips duplicate and cached values\n", func() {
+			plain := []string{"a", "b", "c", "d", "e"}
+			encrypted := make([]string, 0, len(plain)+1)
+			for _, p := range plain {
+				server.AddPlaintext("dk", "enc-"+p, p)
+				encrypted = append(encrypted, "enc-"+p)
+			}
+			encrypted = append(encrypted, "enc-a")
+			_, err := ci.Decrypt(ctx, "enc-c")
+			So(err, ShouldBeNil)
+
+			decrypted, err := ci.BatchDecrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldResemble, append(plain, "a"))
+			So(server.Calls(HAITAI_API_DECRYPT), ShouldEqual, 5)
+
+			_, err = ci.BatchDecrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(server.Calls(HAITAI_API_DECRYPT), ShouldEqual, 5)
+
+			_, err = ci.BatchDecrypt(ctx, []string{"enc-a", "unknown"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("retry on 5xx but not on 4xx\n", func() {
+			server.FailNext(http.StatusServiceUnavailable, http.StatusBadGateway)
+			sign, err := ci.Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(sign, ShouldEqual, "signed")
+			So(server.Calls(HAITAI_API_SIGN), ShouldEqual, 3)
+
+			server.FailNext(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+			_, err = ci.Signature(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+			So(server.Calls(HAITAI_API_SIGN), ShouldEqual, 6)
+
+			server.FailNext(http.StatusBadRequest)
+			_, err = ci.Signature(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+			So(server.Calls(HAITAI_API_SIGN), ShouldEqual, 7)
+		})
+
+		Convey("invalid requests\n", func() {
+			_, err := ci.Decrypt(ctx, "not encrypted")
+			So(err, ShouldNotBeNil)
+
+			wrongKey := NewHaitaiCipherV2("ffeeddccbbaa99887766554433221100", server.URL, "realm", "dk")
+			_, err = wrongKey.Signature(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+
+			badKey := NewHaitaiCipherV2("not hex", server.URL, "realm", "dk")
+			_, err = badKey.Signature(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = ci.Signature(canceled, ODATA)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			So(fmt.Sprint(err), ShouldContainSubstring, HAITAI_API_SIGN)
+		})
+	})
+}
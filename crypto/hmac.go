@@ -0,0 +1,185 @@
+package crypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HMAC 摘要算法
+	HMAC_SHA256 = "SHA256"
+	HMAC_SHA512 = "SHA512"
+
+	// 签名的编码方式, URL 中使用 base64url
+	SIGN_ENCODING_HEX        = "hex"
+	SIGN_ENCODING_BASE64     = "base64"
+	SIGN_ENCODING_BASE64_URL = "base64url"
+
+	// 带时间戳的签名中时间戳与签名的分隔符, 签名为 <unix 秒>.<签名>
+	SIGN_TIMESTAMP_SEPARATOR = "."
+)
+
+var (
+	ErrSignatureExpired = errors.New("crypto: signature timestamp out of window")
+)
+
+// HMAC 签名, 用于 webhook 回调、预签名下载地址等
+type hmacCipher struct {
+	key      []byte
+	hashName string
+	newHash  func() hash.Hash
+	encoding string
+
+	// 大于 0 时签名携带时间戳, 校验时拒绝时间戳超出窗口的签名
+	window time.Duration
+	now    func() time.Time
+}
+
+// HMAC 的可选配置
+type HMACOption func(ci *hmacCipher)
+
+// 设置摘要算法, 默认为 SHA256
+func WithHMACHash(hashName string) HMACOption {
+	return func(ci *hmacCipher) {
+		ci.hashName = hashName
+	}
+}
+
+// 设置签名的编码方式, 默认为 hex
+func WithHMACEncoding(encoding string) HMACOption {
+	return func(ci *hmacCipher) {
+		ci.encoding = encoding
+	}
+}
+
+// 签名携带时间戳, 校验时拒绝时间戳与当前时间相差超过 window 的签名, 防止重放
+func WithHMACTimestamp(window time.Duration) HMACOption {
+	return func(ci *hmacCipher) {
+		ci.window = window
+	}
+}
+
+func NewHMACCipher(key []byte, opts ...HMACOption) (VerifiableCipher, error) {
+	if len(key) == 0 {
+		return nil, errors.New("hmac key is empty")
+	}
+
+	ci := &hmacCipher{
+		key:      key,
+		hashName: HMAC_SHA256,
+		encoding: SIGN_ENCODING_HEX,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(ci)
+	}
+
+	switch ci.hashName {
+	case HMAC_SHA256:
+		ci.newHash = sha256.New
+	case HMAC_SHA512:
+		ci.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("invalid hmac hash: %s", ci.hashName)
+	}
+
+	switch ci.encoding {
+	case SIGN_ENCODING_HEX, SIGN_ENCODING_BASE64, SIGN_ENCODING_BASE64_URL:
+	default:
+		return nil, fmt.Errorf("invalid signature encoding: %s", ci.encoding)
+	}
+	return ci, nil
+}
+
+func (ci hmacCipher) Encrypt(ctx context.Context, data string) (string, error) {
+	return "", fmt.Errorf("hmacCipher Encrypt: %w", ErrNotImplemented)
+}
+
+func (ci hmacCipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	return "", fmt.Errorf("hmacCipher Decrypt: %w", ErrNotImplemented)
+}
+
+// 计算签名, 开启时间戳时签名内容为 <unix 秒>.<signContent>, 返回 <unix 秒>.<签名>
+func (ci hmacCipher) Signature(ctx context.Context, signContent string) (string, error) {
+	if ci.window <= 0 {
+		return ci.encode(ci.sum(signContent)), nil
+	}
+
+	timestamp := strconv.FormatInt(ci.now().Unix(), 10)
+	return timestamp + SIGN_TIMESTAMP_SEPARATOR + ci.encode(ci.sum(timestamp+SIGN_TIMESTAMP_SEPARATOR+signContent)), nil
+}
+
+// 校验签名, 使用常量时间比较
+// 开启时间戳时先校验签名, 再校验时间戳, 时间戳超出窗口时返回 ErrSignatureExpired
+func (ci hmacCipher) Verify(ctx context.Context, signContent string, signature string) error {
+	if ci.window <= 0 {
+		return ci.verify(signContent, signature)
+	}
+
+	timestamp, sign, ok := strings.Cut(signature, SIGN_TIMESTAMP_SEPARATOR)
+	if !ok {
+		return ErrSignatureMismatch
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureMismatch
+	}
+	if err := ci.verify(timestamp+SIGN_TIMESTAMP_SEPARATOR+signContent, sign); err != nil {
+		return err
+	}
+
+	diff := ci.now().Sub(time.Unix(unix, 0))
+	if diff > ci.window || diff < -ci.window {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+func (ci hmacCipher) verify(signContent string, signature string) error {
+	decodedSign, err := ci.decode(signature)
+	if err != nil {
+		return ErrSignatureMismatch
+	}
+	if !hmac.Equal(ci.sum(signContent), decodedSign) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func (ci hmacCipher) sum(signContent string) []byte {
+	h := hmac.New(ci.newHash, ci.key)
+	h.Write([]byte(signContent))
+	return h.Sum(nil)
+}
+
+func (ci hmacCipher) encode(sign []byte) string {
+	switch ci.encoding {
+	case SIGN_ENCODING_BASE64:
+		return base64.StdEncoding.EncodeToString(sign)
+	case SIGN_ENCODING_BASE64_URL:
+		return base64.RawURLEncoding.EncodeToString(sign)
+	default:
+		return hex.EncodeToString(sign)
+	}
+}
+
+func (ci hmacCipher) decode(signature string) ([]byte, error) {
+	switch ci.encoding {
+	case SIGN_ENCODING_BASE64:
+		return base64.StdEncoding.DecodeString(signature)
+	case SIGN_ENCODING_BASE64_URL:
+		return base64.RawURLEncoding.DecodeString(signature)
+	default:
+		return hex.DecodeString(signature)
+	}
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHMAC(t *testing.T) {
+	Convey("test HMAC\n", t, func() {
+		ctx := context.Background()
+		key := []byte("key")
+		content := "The quick brown fox jumps over the lazy dog"
+
+		Convey("SHA256 and SHA512 match RFC test values\n", func() {
+			ci, err := NewHMACCipher(key)
+			So(err, ShouldBeNil)
+			sign, err := ci.Signature(ctx, content)
+			So(err, ShouldBeNil)
+			So(sign, ShouldEqual, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")
+			So(ci.Verify(ctx, content, sign), ShouldBeNil)
+			So(ci.Verify(ctx, content+".", sign), ShouldEqual, ErrSignatureMismatch)
+			So(ci.Verify(ctx, content, "zz"), ShouldEqual, ErrSignatureMismatch)
+
+			ci, err = NewHMACCipher(key, WithHMACHash(HMAC_SHA512))
+			So(err, ShouldBeNil)
+			sign, _ = ci.Signature(ctx, content)
+			So(sign, ShouldStartWith, "b42af09057bac1e2d41708e48a902e09b5ff7f12ab428a4fe86653c73dd248fb")
+		})
+
+		Convey("base64 encodings\n", func() {
+			std, err := NewHMACCipher(key, WithHMACEncoding(SIGN_ENCODING_BASE64))
+			So(err, ShouldBeNil)
+			sign, _ := std.Signature(ctx, content)
+			So(sign, ShouldEqual, "97yD9DBThCSxMpjmqm+xQ+9NWaFJRhdZl0edvC0aPNg=")
+			So(std.Verify(ctx, content, sign), ShouldBeNil)
+
+			url, err := NewHMACCipher(key, WithHMACEncoding(SIGN_ENCODING_BASE64_URL))
+			So(err, ShouldBeNil)
+			sign, _ = url.Signature(ctx, content)
+			So(sign, ShouldEqual, "97yD9DBThCSxMpjmqm-xQ-9NWaFJRhdZl0edvC0aPNg")
+			So(url.Verify(ctx, content, sign), ShouldBeNil)
+		})
+
+		Convey("timestamped signatures reject replays\n", func() {
+			ci, err := NewHMACCipher(key, WithHMACTimestamp(5*time.Minute))
+			So(err, ShouldBeNil)
+			hc := ci.(*hmacCipher)
+			now := time.Unix(1700000000, 0)
+			hc.now = func() time.Time { return now }
+
+			sign, err := ci.Signature(ctx, content)
+			So(err, ShouldBeNil)
+			So(sign, ShouldStartWith, "1700000000.")
+			So(ci.Verify(ctx, content, sign), ShouldBeNil)
+
+			now = now.Add(4 * time.Minute)
+			So(ci.Verify(ctx, content, sign), ShouldBeNil)
+			now = now.Add(2 * time.Minute)
+			So(ci.Verify(ctx, content, sign), ShouldEqual, ErrSignatureExpired)
+
+			// 修改时间戳后签名不匹配
+			forged := "1700000300" + sign[strings.Index(sign, "."):]
+			So(ci.Verify(ctx, content, forged), ShouldEqual, ErrSignatureMismatch)
+			So(ci.Verify(ctx, content, "no-timestamp"), ShouldEqual, ErrSignatureMismatch)
+			So(ci.Verify(ctx, content, "abc.def"), ShouldEqual, ErrSignatureMismatch)
+		})
+
+		Convey("invalid options\n", func() {
+			_, err := NewHMACCipher(nil)
+			So(err, ShouldNotBeNil)
+			_, err = NewHMACCipher(key, WithHMACHash("MD5"))
+			So(err, ShouldNotBeNil)
+			_, err = NewHMACCipher(key, WithHMACEncoding("base32"))
+			So(err, ShouldNotBeNil)
+
+			ci, _ := NewHMACCipher(key)
+			_, err = ci.Encrypt(ctx, content)
+			So(err, ShouldNotBeNil)
+			_, err = ci.Decrypt(ctx, content)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
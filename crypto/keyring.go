@@ -0,0 +1,442 @@
+package crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bytedance/sonic"
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+// 密钥状态
+type KeyState string
+
+const (
+	KEY_STATE_ACTIVE       KeyState = "active"       // 用于加密和解密, 同一时间只有一个
+	KEY_STATE_DECRYPT_ONLY KeyState = "decrypt_only" // 只用于解密旧的密文
+	KEY_STATE_RETIRED      KeyState = "retired"      // 不再使用, 解密时返回 ErrKeyRetired
+)
+
+// 是否为已定义的状态
+func (s KeyState) valid() bool {
+	switch s {
+	case KEY_STATE_ACTIVE, KEY_STATE_DECRYPT_ONLY, KEY_STATE_RETIRED:
+		return true
+	default:
+		return false
+	}
+}
+
+// 密钥算法, 主密钥和数据密钥使用相同的算法
+const (
+	KEY_ALGORITHM_AES_256_GCM = "AES-256-GCM"
+	KEY_ALGORITHM_SM4_GCM     = "SM4-GCM"
+)
+
+const (
+	// 挂载 kubernetes secret 或读取 secret 数据时, 密钥环所在的文件名
+	KEYRING_SECRET_KEY = "keyring.json"
+
+	// 密钥环密文格式的版本
+	// 密文为 base64(版本 + 包装后的数据密钥长度(2字节) + 包装后的数据密钥 + nonce + 密文 + tag)
+	// 包装后的数据密钥为 版本 + 主密钥ID长度(1字节) + 主密钥ID + nonce + 数据密钥密文 + tag
+	KEYRING_VERSION byte = 0x02
+)
+
+var (
+	ErrKeyNotFound     = errors.New("crypto: key not found")
+	ErrKeyRetired      = errors.New("crypto: key is retired")
+	ErrNoActiveKey     = errors.New("crypto: keyring has no active key")
+	ErrInvalidKeyID    = errors.New("crypto: invalid key id")
+	ErrInvalidKeyState = errors.New("crypto: invalid key state")
+)
+
+// 主密钥
+// Material 为密钥原文, JSON 中为 base64 编码
+type Key struct {
+	ID        string   `json:"id"`
+	Algorithm string   `json:"algorithm"`
+	Material  []byte   `json:"key"`
+	State     KeyState `json:"state"`
+}
+
+// 密钥环, 保存多个带ID和状态的主密钥, 使用信封加密
+// 每次加密生成随机的数据密钥, 用数据密钥加密数据, 再用当前主密钥包装数据密钥, 密文中携带主密钥ID
+// 轮换时添加新的主密钥并设置为 active, 原主密钥自动变为 decrypt_only, 旧的密文仍可解密, 再通过 ReEncrypt 逐步迁移
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]*keyringKey
+	active string
+}
+
+type keyringKey struct {
+	Key
+	aead cipher.AEAD
+}
+
+// 密钥环的 JSON 格式
+type keyringDocument struct {
+	Keys []Key `json:"keys"`
+}
+
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	k := &Keyring{
+		keys: map[string]*keyringKey{},
+	}
+	for _, key := range keys {
+		if key.State == KEY_STATE_ACTIVE && k.active != "" {
+			return nil, fmt.Errorf("keyring has more than one active key: %s, %s", k.active, key.ID)
+		}
+		if err := k.Add(key); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// 解析 JSON 格式的密钥环, 如:
+//
+//	{"keys": [{"id": "2025", "algorithm": "AES-256-GCM", "key": "<base64>", "state": "active"}]}
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var doc keyringDocument
+	if err := sonic.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshal keyring failed: %w", err)
+	}
+	return NewKeyring(doc.Keys...)
+}
+
+// 从文件加载密钥环, kubernetes secret 挂载为目录时, 文件为目录下的 KEYRING_SECRET_KEY
+func LoadKeyringFromFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keyring file %s failed: %w", path, err)
+	}
+	return ParseKeyring(data)
+}
+
+// 从 kubernetes secret 的数据中加载密钥环
+func LoadKeyringFromSecret(data map[string][]byte) (*Keyring, error) {
+	content, ok := data[KEYRING_SECRET_KEY]
+	if !ok {
+		return nil, fmt.Errorf("secret has no %s", KEYRING_SECRET_KEY)
+	}
+	return ParseKeyring(content)
+}
+
+// 添加主密钥, 状态为空时为 decrypt_only, 状态为 active 时原 active 主密钥变为 decrypt_only
+// 状态不是已定义的状态时返回 ErrInvalidKeyState
+func (k *Keyring) Add(key Key) error {
+	if key.ID == "" || len(key.ID) > 255 {
+		return ErrInvalidKeyID
+	}
+	if key.Algorithm == "" {
+		key.Algorithm = KEY_ALGORITHM_AES_256_GCM
+	}
+	if key.State == "" {
+		key.State = KEY_STATE_DECRYPT_ONLY
+	}
+	if !key.State.valid() {
+		return fmt.Errorf("key %s: %w: %q", key.ID, ErrInvalidKeyState, key.State)
+	}
+
+	aead, err := newKeyAEAD(key.Algorithm, key.Material)
+	if err != nil {
+		return fmt.Errorf("key %s: %w", key.ID, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[key.ID]; ok {
+		return fmt.Errorf("key %s already exists", key.ID)
+	}
+	k.keys[key.ID] = &keyringKey{Key: key, aead: aead}
+	if key.State == KEY_STATE_ACTIVE {
+		k.activate(key.ID)
+	}
+	return nil
+}
+
+// 修改主密钥的状态, 设置为 active 时原 active 主密钥变为 decrypt_only
+func (k *Keyring) SetState(id string, state KeyState) error {
+	if !state.valid() {
+		return fmt.Errorf("key %s: %w: %q", id, ErrInvalidKeyState, state)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return fmt.Errorf("key %s: %w", id, ErrKeyNotFound)
+	}
+
+	switch state {
+	case KEY_STATE_ACTIVE:
+		k.activate(id)
+	default:
+		key.State = state
+		if k.active == id {
+			k.active = ""
+		}
+	}
+	return nil
+}
+
+// 调用方需持有锁
+func (k *Keyring) activate(id string) {
+	if current, ok := k.keys[k.active]; ok && k.active != id {
+		current.State = KEY_STATE_DECRYPT_ONLY
+	}
+	k.keys[id].State = KEY_STATE_ACTIVE
+	k.active = id
+}
+
+// 获取当前 active 主密钥的ID, 没有时返回空
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+// 获取所有主密钥的ID、算法和状态, 不包括密钥原文, 按ID排序
+func (k *Keyring) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]Key, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, Key{ID: key.ID, Algorithm: key.Algorithm, State: key.State})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// 生成数据密钥, 返回数据密钥原文、包装后的数据密钥和数据密钥的算法
+// 数据密钥由当前 active 主密钥包装, 包装后的数据密钥中携带主密钥ID, 可与密文一起保存
+func (k *Keyring) GenerateDataKey() (dataKey []byte, wrappedKey []byte, algorithm string, err error) {
+	k.mu.RLock()
+	master, ok := k.keys[k.active]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, nil, "", ErrNoActiveKey
+	}
+
+	dataKey = make([]byte, len(master.Material))
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, nil, "", fmt.Errorf("generate data key failed: %w", err)
+	}
+
+	header := make([]byte, 0, 2+len(master.ID))
+	header = append(header, KEYRING_VERSION, byte(len(master.ID)))
+	header = append(header, master.ID...)
+
+	nonce := make([]byte, master.aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, "", fmt.Errorf("generate nonce failed: %w", err)
+	}
+
+	wrappedKey = append(header, nonce...)
+	wrappedKey = master.aead.Seal(wrappedKey, nonce, dataKey, header)
+	return dataKey, wrappedKey, master.Algorithm, nil
+}
+
+// 使用包装时的主密钥解开数据密钥, 返回数据密钥原文和算法
+func (k *Keyring) UnwrapDataKey(wrappedKey []byte) (dataKey []byte, algorithm string, err error) {
+	id, err := wrappedKeyID(wrappedKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	k.mu.RLock()
+	master, ok := k.keys[id]
+	var state KeyState
+	if ok {
+		state = master.State
+	}
+	k.mu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("key %s: %w", id, ErrKeyNotFound)
+	}
+	if state == KEY_STATE_RETIRED {
+		return nil, "", fmt.Errorf("key %s: %w", id, ErrKeyRetired)
+	}
+
+	headerSize := 2 + len(id)
+	nonceSize := master.aead.NonceSize()
+	if len(wrappedKey) < headerSize+nonceSize+master.aead.Overhead() {
+		return nil, "", ErrInvalidCiphertext
+	}
+	nonce := wrappedKey[headerSize : headerSize+nonceSize]
+	dataKey, err = master.aead.Open(nil, nonce, wrappedKey[headerSize+nonceSize:], wrappedKey[:headerSize])
+	if err != nil {
+		return nil, "", fmt.Errorf("unwrap data key with key %s failed: %w", id, err)
+	}
+	return dataKey, master.Algorithm, nil
+}
+
+func (k *Keyring) Encrypt(ctx context.Context, data string) (string, error) {
+	return k.EncryptWithAAD(ctx, data, nil)
+}
+
+func (k *Keyring) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	return k.DecryptWithAAD(ctx, encryptedData, nil)
+}
+
+// 使用新的数据密钥加密, 附加数据和密文头都参与认证
+func (k *Keyring) EncryptWithAAD(ctx context.Context, data string, aad []byte) (string, error) {
+	dataKey, wrappedKey, algorithm, err := k.GenerateDataKey()
+	if err != nil {
+		return "", err
+	}
+	aead, err := newKeyAEAD(algorithm, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	header := make([]byte, 3, 3+len(wrappedKey))
+	header[0] = KEYRING_VERSION
+	binary.BigEndian.PutUint16(header[1:3], uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce failed: %w", err)
+	}
+
+	encrypted := append(header, nonce...)
+	encrypted = aead.Seal(encrypted, nonce, []byte(data), append(header[:len(header):len(header)], aad...))
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (k *Keyring) DecryptWithAAD(ctx context.Context, encryptedData string, aad []byte) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode keyring ciphertext failed: %w", err)
+	}
+	header, body, err := splitKeyringCiphertext(encrypted)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, algorithm, err := k.UnwrapDataKey(header[3:])
+	if err != nil {
+		return "", err
+	}
+	aead, err := newKeyAEAD(algorithm, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(body) < nonceSize+aead.Overhead() {
+		return "", ErrInvalidCiphertext
+	}
+	decrypted, err := aead.Open(nil, body[:nonceSize], body[nonceSize:], append(header[:len(header):len(header)], aad...))
+	if err != nil {
+		return "", fmt.Errorf("keyring authentication failed: %w", err)
+	}
+	return string(decrypted), nil
+}
+
+func (k *Keyring) Signature(ctx context.Context, signContent string) (string, error) {
+	return "", fmt.Errorf("keyring Signature: %w", ErrNotImplemented)
+}
+
+// 使用当前 active 主密钥重新加密, 密文已使用 active 主密钥时原样返回
+// 返回的 bool 表示是否重新加密, 用于批量迁移旧的密文后再将旧主密钥设置为 retired
+func (k *Keyring) ReEncrypt(ctx context.Context, encryptedData string) (string, bool, error) {
+	return k.ReEncryptWithAAD(ctx, encryptedData, nil)
+}
+
+func (k *Keyring) ReEncryptWithAAD(ctx context.Context, encryptedData string, aad []byte) (string, bool, error) {
+	id, err := KeyIDOf(encryptedData)
+	if err != nil {
+		return "", false, err
+	}
+	if id == k.ActiveKeyID() {
+		return encryptedData, false, nil
+	}
+
+	data, err := k.DecryptWithAAD(ctx, encryptedData, aad)
+	if err != nil {
+		return "", false, err
+	}
+	reEncrypted, err := k.EncryptWithAAD(ctx, data, aad)
+	if err != nil {
+		return "", false, err
+	}
+	return reEncrypted, true, nil
+}
+
+// 获取密钥环密文使用的主密钥ID
+func KeyIDOf(encryptedData string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode keyring ciphertext failed: %w", err)
+	}
+	header, _, err := splitKeyringCiphertext(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return wrappedKeyID(header[3:])
+}
+
+// 拆分密钥环密文的头 (版本 + 长度 + 包装后的数据密钥) 和密文
+func splitKeyringCiphertext(encrypted []byte) ([]byte, []byte, error) {
+	if len(encrypted) < 3 || encrypted[0] != KEYRING_VERSION {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	headerSize := 3 + int(binary.BigEndian.Uint16(encrypted[1:3]))
+	if len(encrypted) < headerSize {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	return encrypted[:headerSize], encrypted[headerSize:], nil
+}
+
+func wrappedKeyID(wrappedKey []byte) (string, error) {
+	if len(wrappedKey) < 2 || wrappedKey[0] != KEYRING_VERSION {
+		return "", ErrInvalidCiphertext
+	}
+	idSize := int(wrappedKey[1])
+	if idSize == 0 || len(wrappedKey) < 2+idSize {
+		return "", ErrInvalidCiphertext
+	}
+	return string(wrappedKey[2 : 2+idSize]), nil
+}
+
+// 根据算法创建 AEAD
+func newKeyAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	var (
+		block cipher.Block
+		err   error
+	)
+	switch algorithm {
+	case KEY_ALGORITHM_AES_256_GCM:
+		if len(key) != AES_256_KEY_SIZE {
+			return nil, fmt.Errorf("invalid AES-256 key size %d, expected %d", len(key), AES_256_KEY_SIZE)
+		}
+		block, err = aes.NewCipher(key)
+	case KEY_ALGORITHM_SM4_GCM:
+		if len(key) != SM4_KEY_SIZE {
+			return nil, fmt.Errorf("invalid SM4 key size %d, expected %d", len(key), SM4_KEY_SIZE)
+		}
+		block, err = sm4.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("invalid key algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s cipher failed: %w", algorithm, err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeyring(t *testing.T) {
+	Convey("test keyring\n", t, func() {
+		ctx := context.Background()
+		oldKey := Key{ID: "2024", Material: bytes.Repeat([]byte{1}, AES_256_KEY_SIZE), State: KEY_STATE_ACTIVE}
+		newKey := Key{ID: "2025", Algorithm: KEY_ALGORITHM_SM4_GCM, Material: bytes.Repeat([]byte{2}, SM4_KEY_SIZE)}
+
+		kr, err := NewKeyring(oldKey, newKey)
+		So(err, ShouldBeNil)
+		So(kr.ActiveKeyID(), ShouldEqual, "2024")
+
+		encrypted, err := kr.EncryptWithAAD(ctx, ODATA, []byte("row-1"))
+		So(err, ShouldBeNil)
+		id, err := KeyIDOf(encrypted)
+		So(err, ShouldBeNil)
+		So(id, ShouldEqual, "2024")
+
+		Convey("decrypt with associated data\n", func() {
+			decrypted, err := kr.DecryptWithAAD(ctx, encrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			_, err = kr.DecryptWithAAD(ctx, encrypted, []byte("row-2"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("rotate and re-encrypt\n", func() {
+			So(kr.SetState("2025", KEY_STATE_ACTIVE), ShouldBeNil)
+			So(kr.ActiveKeyID(), ShouldEqual, "2025")
+			So(kr.Keys(), ShouldResemble, []Key{
+				{ID: "2024", Algorithm: KEY_ALGORITHM_AES_256_GCM, State: KEY_STATE_DECRYPT_ONLY},
+				{ID: "2025", Algorithm: KEY_ALGORITHM_SM4_GCM, State: KEY_STATE_ACTIVE},
+			})
+
+			decrypted, err := kr.DecryptWithAAD(ctx, encrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			reEncrypted, changed, err := kr.ReEncryptWithAAD(ctx, encrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(changed, ShouldBeTrue)
+			id, _ := KeyIDOf(reEncrypted)
+			So(id, ShouldEqual, "2025")
+
+			again, changed, err := kr.ReEncryptWithAAD(ctx, reEncrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(changed, ShouldBeFalse)
+			So(again, ShouldEqual, reEncrypted)
+
+			So(kr.SetState("2024", KEY_STATE_RETIRED), ShouldBeNil)
+			_, err = kr.Decrypt(ctx, encrypted)
+			So(errors.Is(err, ErrKeyRetired), ShouldBeTrue)
+			decrypted, err = kr.DecryptWithAAD(ctx, reEncrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("envelope data keys\n", func() {
+			dataKey, wrappedKey, algorithm, err := kr.GenerateDataKey()
+			So(err, ShouldBeNil)
+			So(algorithm, ShouldEqual, KEY_ALGORITHM_AES_256_GCM)
+			So(len(dataKey), ShouldEqual, AES_256_KEY_SIZE)
+
+			unwrapped, _, err := kr.UnwrapDataKey(wrappedKey)
+			So(err, ShouldBeNil)
+			So(unwrapped, ShouldResemble, dataKey)
+
+			wrappedKey[len(wrappedKey)-1] ^= 0xff
+			_, _, err = kr.UnwrapDataKey(wrappedKey)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("no active key\n", func() {
+			So(kr.SetState("2024", KEY_STATE_DECRYPT_ONLY), ShouldBeNil)
+			_, err := kr.Encrypt(ctx, ODATA)
+			So(err, ShouldEqual, ErrNoActiveKey)
+		})
+
+		Convey("unknown key and malformed input\n", func() {
+			other, err := NewKeyring(Key{ID: "other", Material: oldKey.Material, State: KEY_STATE_ACTIVE})
+			So(err, ShouldBeNil)
+			_, err = other.Decrypt(ctx, encrypted)
+			So(errors.Is(err, ErrKeyNotFound), ShouldBeTrue)
+
+			_, err = kr.Decrypt(ctx, base64.StdEncoding.EncodeToString([]byte{KEYRING_VERSION, 0xff}))
+			So(err, ShouldEqual, ErrInvalidCiphertext)
+			_, err = KeyIDOf("not base64")
+			So(err, ShouldNotBeNil)
+			_, err = kr.Signature(ctx, ODATA)
+			So(errors.Is(err, ErrNotImplemented), ShouldBeTrue)
+		})
+
+		Convey("invalid keys\n", func() {
+			_, err := NewKeyring(oldKey, Key{ID: "2025", Material: oldKey.Material, State: KEY_STATE_ACTIVE})
+			So(err, ShouldNotBeNil)
+			So(kr.Add(oldKey), ShouldNotBeNil)
+			So(kr.Add(Key{ID: "short", Material: []byte(KEY)}), ShouldNotBeNil)
+			So(kr.Add(Key{ID: "", Material: oldKey.Material}), ShouldEqual, ErrInvalidKeyID)
+			So(kr.SetState("missing", KEY_STATE_ACTIVE), ShouldNotBeNil)
+			So(errors.Is(kr.SetState("2024", "retire"), ErrInvalidKeyState), ShouldBeTrue)
+			So(errors.Is(kr.Add(Key{ID: "2025", Material: oldKey.Material, State: "retire"}), ErrInvalidKeyState), ShouldBeTrue)
+			_, err = ParseKeyring([]byte(fmt.Sprintf(`{"keys": [{"id": "2025", "key": "%s", "state": "Active"}]}`,
+				base64.StdEncoding.EncodeToString(oldKey.Material))))
+			So(errors.Is(err, ErrInvalidKeyState), ShouldBeTrue)
+		})
+	})
+
+	Convey("test load keyring\n", t, func() {
+		content := []byte(fmt.Sprintf(`{"keys": [{"id": "2025", "key": "%s", "state": "active"}]}`,
+			base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, AES_256_KEY_SIZE))))
+
+		Convey("from file\n", func() {
+			path := filepath.Join(t.TempDir(), KEYRING_SECRET_KEY)
+			So(os.WriteFile(path, content, 0600), ShouldBeNil)
+
+			kr, err := LoadKeyringFromFile(path)
+			So(err, ShouldBeNil)
+			So(kr.ActiveKeyID(), ShouldEqual, "2025")
+
+			_, err = LoadKeyringFromFile(filepath.Join(t.TempDir(), "missing.json"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("from secret\n", func() {
+			kr, err := LoadKeyringFromSecret(map[string][]byte{KEYRING_SECRET_KEY: content})
+			So(err, ShouldBeNil)
+			So(kr.ActiveKeyID(), ShouldEqual, "2025")
+
+			_, err = LoadKeyringFromSecret(map[string][]byte{})
+			So(err, ShouldNotBeNil)
+			_, err = ParseKeyring([]byte("{"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
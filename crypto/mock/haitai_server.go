@@ -0,0 +1,157 @@
+package mock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// 海泰密码服务的本地替身, 用于测试客户端的重试、缓存和批量解密
+// 实现 encrypt、decrypt、sign、verify 接口, 请求和响应的格式与 crypto.HAITAI_API_* 的说明一致
+// 不模拟密码服务的算法, 明文和密文的对应关系、签名结果由测试通过 AddPlaintext、AddSignature 预先设置
+type HaitaiServer struct {
+	*httptest.Server
+
+	key []byte
+
+	mu          sync.Mutex
+	plaintexts  map[string]string
+	ciphertexts map[string]string
+	signatures  map[string]string
+	calls       map[string]int
+	failures    []int
+}
+
+// 启动密码服务替身, key 为 hex 编码的 hmac 密钥, 与客户端一致, 校验请求的 hmac 头
+func NewHaitaiServer(key string) *HaitaiServer {
+	hmacKey, _ := hex.DecodeString(key)
+	s := &HaitaiServer{
+		key:         hmacKey,
+		plaintexts:  map[string]string{},
+		ciphertexts: map[string]string{},
+		signatures:  map[string]string{},
+		calls:       map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// 设置密文和明文的对应关系, encrypt 返回明文对应的密文, decrypt 返回密文对应的明文, 未设置的返回 400
+func (s *HaitaiServer) AddPlaintext(dataKey string, encrypted string, plaintext string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.plaintexts[dataKey+"\x00"+encrypted] = plaintext
+	s.ciphertexts[dataKey+"\x00"+plaintext] = encrypted
+}
+
+// 设置内容对应的签名, sign 返回该签名, 未设置的内容返回 400, verify 校验签名与之相同
+func (s *HaitaiServer) AddSignature(data string, signature string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signatures[data] = signature
+}
+
+// 接下来的请求依次返回指定的 HTTP 状态码, 用于模拟服务故障
+func (s *HaitaiServer) FailNext(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, statusCodes...)
+}
+
+// 获取接口被调用的次数, 包括失败的请求
+func (s *HaitaiServer) Calls(api string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[api]
+}
+
+func (s *HaitaiServer) handle(w http.ResponseWriter, r *http.Request) {
+	api := strings.TrimPrefix(r.URL.Path, "/ded-service/api/")
+
+	s.mu.Lock()
+	s.calls[api]++
+	var failure int
+	if len(s.failures) > 0 {
+		failure = s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if failure != 0 {
+		writeHaitaiResponse(w, failure, map[string]interface{}{"message": "injected failure"})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeHaitaiResponse(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+	if !hmac.Equal([]byte(r.Header.Get("hmac")), []byte(s.digest(body))) {
+		writeHaitaiResponse(w, http.StatusUnauthorized, map[string]interface{}{"message": "hmac mismatch"})
+		return
+	}
+
+	var req struct {
+		Data      string `json:"data"`
+		DataKey   string `json:"dataKey"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeHaitaiResponse(w, http.StatusBadRequest, map[string]interface{}{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	var (
+		data interface{}
+		ok   bool
+	)
+	switch api {
+	case "encrypt":
+		data, ok = s.ciphertexts[req.DataKey+"\x00"+req.Data]
+	case "decrypt":
+		data, ok = s.plaintexts[req.DataKey+"\x00"+req.Data]
+	case "sign":
+		data, ok = s.signatures[req.Data]
+	case "verify":
+		var signature string
+		signature, ok = s.signatures[req.Data]
+		data = ok && hmac.Equal([]byte(signature), []byte(req.Signature))
+		ok = true
+	default:
+		s.mu.Unlock()
+		writeHaitaiResponse(w, http.StatusNotFound, map[string]interface{}{"message": "api not found"})
+		return
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeHaitaiResponse(w, http.StatusBadRequest, map[string]interface{}{"message": "unknown data"})
+		return
+	}
+	writeHaitaiResponse(w, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+// 与客户端一致的请求摘要, HMAC-SHA256 的大写 hex
+func (s *HaitaiServer) digest(body []byte) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(body)
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+func writeHaitaiResponse(w http.ResponseWriter, statusCode int, resp map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(resp)
+}
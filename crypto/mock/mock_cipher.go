@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -74,3 +75,289 @@ func (mr *MockCipherMockRecorder) Signature(signContent interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Signature", reflect.TypeOf((*MockCipher)(nil).Signature), signContent)
 }
+
+// MockCipherV2 is a mock of CipherV2 interface.
+type MockCipherV2 struct {
+	ctrl     *gomock.Controller
+	recorder *MockCipherV2MockRecorder
+}
+
+// MockCipherV2MockRecorder is the mock recorder for MockCipherV2.
+type MockCipherV2MockRecorder struct {
+	mock *MockCipherV2
+}
+
+// NewMockCipherV2 creates a new mock instance.
+func NewMockCipherV2(ctrl *gomock.Controller) *MockCipherV2 {
+	mock := &MockCipherV2{ctrl: ctrl}
+	mock.recorder = &MockCipherV2MockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCipherV2) EXPECT() *MockCipherV2MockRecorder {
+	return m.recorder
+}
+
+// Decrypt mocks base method.
+func (m *MockCipherV2) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decrypt", ctx, encryptedData)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decrypt indicates an expected call of Decrypt.
+func (mr *MockCipherV2MockRecorder) Decrypt(ctx, encryptedData interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decrypt", reflect.TypeOf((*MockCipherV2)(nil).Decrypt), ctx, encryptedData)
+}
+
+// Encrypt mocks base method.
+func (m *MockCipherV2) Encrypt(ctx context.Context, data string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Encrypt", ctx, data)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Encrypt indicates an expected call of Encrypt.
+func (mr *MockCipherV2MockRecorder) Encrypt(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encrypt", reflect.TypeOf((*MockCipherV2)(nil).Encrypt), ctx, data)
+}
+
+// Signature mocks base method.
+func (m *MockCipherV2) Signature(ctx context.Context, signContent string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Signature", ctx, signContent)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Signature indicates an expected call of Signature.
+func (mr *MockCipherV2MockRecorder) Signature(ctx, signContent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Signature", reflect.TypeOf((*MockCipherV2)(nil).Signature), ctx, signContent)
+}
+
+// MockVerifiableCipher is a mock of VerifiableCipher interface.
+type MockVerifiableCipher struct {
+	ctrl     *gomock.Controller
+	recorder *MockVerifiableCipherMockRecorder
+}
+
+// MockVerifiableCipherMockRecorder is the mock recorder for MockVerifiableCipher.
+type MockVerifiableCipherMockRecorder struct {
+	mock *MockVerifiableCipher
+}
+
+// NewMockVerifiableCipher creates a new mock instance.
+func NewMockVerifiableCipher(ctrl *gomock.Controller) *MockVerifiableCipher {
+	mock := &MockVerifiableCipher{ctrl: ctrl}
+	mock.recorder = &MockVerifiableCipherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockVerifiableCipher) EXPECT() *MockVerifiableCipherMockRecorder {
+	return m.recorder
+}
+
+// Decrypt mocks base method.
+func (m *MockVerifiableCipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decrypt", ctx, encryptedData)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decrypt indicates an expected call of Decrypt.
+func (mr *MockVerifiableCipherMockRecorder) Decrypt(ctx, encryptedData interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decrypt", reflect.TypeOf((*MockVerifiableCipher)(nil).Decrypt), ctx, encryptedData)
+}
+
+// Encrypt mocks base method.
+func (m *MockVerifiableCipher) Encrypt(ctx context.Context, data string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Encrypt", ctx, data)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Encrypt indicates an expected call of Encrypt.
+func (mr *MockVerifiableCipherMockRecorder) Encrypt(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encrypt", reflect.TypeOf((*MockVerifiableCipher)(nil).Encrypt), ctx, data)
+}
+
+// Signature mocks base method.
+func (m *MockVerifiableCipher) Signature(ctx context.Context, signContent string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Signature", ctx, signContent)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Signature indicates an expected call of Signature.
+func (mr *MockVerifiableCipherMockRecorder) Signature(ctx, signContent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Signature", reflect.TypeOf((*MockVerifiableCipher)(nil).Signature), ctx, signContent)
+}
+
+// Verify mocks base method.
+func (m *MockVerifiableCipher) Verify(ctx context.Context, signContent, signature string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, signContent, signature)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockVerifiableCipherMockRecorder) Verify(ctx, signContent, signature interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockVerifiableCipher)(nil).Verify), ctx, signContent, signature)
+}
+
+// MockAEADCipher is a mock of AEADCipher interface.
+type MockAEADCipher struct {
+	ctrl     *gomock.Controller
+	recorder *MockAEADCipherMockRecorder
+}
+
+// MockAEADCipherMockRecorder is the mock recorder for MockAEADCipher.
+type MockAEADCipherMockRecorder struct {
+	mock *MockAEADCipher
+}
+
+// NewMockAEADCipher creates a new mock instance.
+func NewMockAEADCipher(ctrl *gomock.Controller) *MockAEADCipher {
+	mock := &MockAEADCipher{ctrl: ctrl}
+	mock.recorder = &MockAEADCipherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAEADCipher) EXPECT() *MockAEADCipherMockRecorder {
+	return m.recorder
+}
+
+// Decrypt mocks base method.
+func (m *MockAEADCipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decrypt", ctx, encryptedData)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Decrypt indicates an expected call of Decrypt.
+func (mr *MockAEADCipherMockRecorder) Decrypt(ctx, encryptedData interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decrypt", reflect.TypeOf((*MockAEADCipher)(nil).Decrypt), ctx, encryptedData)
+}
+
+// DecryptWithAAD mocks base method.
+func (m *MockAEADCipher) DecryptWithAAD(ctx context.Context, encryptedData string, aad []byte) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DecryptWithAAD", ctx, encryptedData, aad)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DecryptWithAAD indicates an expected call of DecryptWithAAD.
+func (mr *MockAEADCipherMockRecorder) DecryptWithAAD(ctx, encryptedData, aad interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecryptWithAAD", reflect.TypeOf((*MockAEADCipher)(nil).DecryptWithAAD), ctx, encryptedData, aad)
+}
+
+// Encrypt mocks base method.
+func (m *MockAEADCipher) Encrypt(ctx context.Context, data string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Encrypt", ctx, data)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Encrypt indicates an expected call of Encrypt.
+func (mr *MockAEADCipherMockRecorder) Encrypt(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Encrypt", reflect.TypeOf((*MockAEADCipher)(nil).Encrypt), ctx, data)
+}
+
+// EncryptWithAAD mocks base method.
+func (m *MockAEADCipher) EncryptWithAAD(ctx context.Context, data string, aad []byte) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EncryptWithAAD", ctx, data, aad)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EncryptWithAAD indicates an expected call of EncryptWithAAD.
+func (mr *MockAEADCipherMockRecorder) EncryptWithAAD(ctx, data, aad interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EncryptWithAAD", reflect.TypeOf((*MockAEADCipher)(nil).EncryptWithAAD), ctx, data, aad)
+}
+
+// Signature mocks base method.
+func (m *MockAEADCipher) Signature(ctx context.Context, signContent string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Signature", ctx, signContent)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Signature indicates an expected call of Signature.
+func (mr *MockAEADCipherMockRecorder) Signature(ctx, signContent interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Signature", reflect.TypeOf((*MockAEADCipher)(nil).Signature), ctx, signContent)
+}
+
+// MockLegacyDecrypter is a mock of LegacyDecrypter interface.
+type MockLegacyDecrypter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLegacyDecrypterMockRecorder
+}
+
+// MockLegacyDecrypterMockRecorder is the mock recorder for MockLegacyDecrypter.
+type MockLegacyDecrypterMockRecorder struct {
+	mock *MockLegacyDecrypter
+}
+
+// NewMockLegacyDecrypter creates a new mock instance.
+func NewMockLegacyDecrypter(ctrl *gomock.Controller) *MockLegacyDecrypter {
+	mock := &MockLegacyDecrypter{ctrl: ctrl}
+	mock.recorder = &MockLegacyDecrypterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLegacyDecrypter) EXPECT() *MockLegacyDecrypterMockRecorder {
+	return m.recorder
+}
+
+// DecryptLegacy mocks base method.
+func (m *MockLegacyDecrypter) DecryptLegacy(ctx context.Context, encryptedData string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DecryptLegacy", ctx, encryptedData)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DecryptLegacy indicates an expected call of DecryptLegacy.
+func (mr *MockLegacyDecrypterMockRecorder) DecryptLegacy(ctx, encryptedData interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecryptLegacy", reflect.TypeOf((*MockLegacyDecrypter)(nil).DecryptLegacy), ctx, encryptedData)
+}
@@ -0,0 +1,367 @@
+package crypto
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 口令哈希算法
+const (
+	PASSWORD_ARGON2ID      = "argon2id"
+	PASSWORD_BCRYPT        = "bcrypt"
+	PASSWORD_PBKDF2_SHA256 = "pbkdf2-sha256"
+	PASSWORD_PBKDF2_SHA512 = "pbkdf2-sha512"
+)
+
+// 默认参数, 参考 OWASP 口令存储的建议
+const (
+	DEFAULT_ARGON2_MEMORY      uint32 = 64 * 1024 // KiB
+	DEFAULT_ARGON2_ITERATIONS  uint32 = 3
+	DEFAULT_ARGON2_PARALLELISM uint8  = 4
+	DEFAULT_BCRYPT_COST               = 12
+	DEFAULT_PBKDF2_ITERATIONS         = 600000
+
+	PASSWORD_SALT_SIZE = 16
+	PASSWORD_KEY_SIZE  = 32
+)
+
+// 参数上限, 校验时哈希结果中的参数超过上限返回 ErrInvalidHash, 避免构造的哈希消耗过多内存和 CPU
+const (
+	MAX_ARGON2_MEMORY      uint32 = 1024 * 1024 // KiB, 即 1 GiB
+	MAX_ARGON2_ITERATIONS  uint32 = 64
+	MAX_ARGON2_PARALLELISM uint8  = 64
+	MAX_PBKDF2_ITERATIONS         = 10000000
+)
+
+var (
+	ErrPasswordMismatch = errors.New("crypto: password mismatch")
+	ErrInvalidHash      = errors.New("crypto: invalid password hash")
+)
+
+// 默认的口令哈希, 使用 argon2id, 默认参数总是合法
+var defaultPasswordHasher, _ = NewPasswordHasher()
+
+// 口令哈希
+// 哈希结果为 PHC 格式, 如 $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>、$pbkdf2-sha256$i=600000$<salt>$<hash>
+// bcrypt 使用其自身的格式 $2a$12$...
+// 校验时根据哈希结果中的算法和参数计算, 与当前配置无关, 因此修改配置后旧的哈希结果仍可校验
+type PasswordHasher struct {
+	algorithm         string
+	argon2Memory      uint32
+	argon2Iterations  uint32
+	argon2Parallelism uint8
+	bcryptCost        int
+	pbkdf2Iterations  int
+}
+
+// 口令哈希的可选配置
+type PasswordOption func(h *PasswordHasher)
+
+// 设置新哈希使用的算法, 默认为 argon2id
+func WithPasswordAlgorithm(algorithm string) PasswordOption {
+	return func(h *PasswordHasher) {
+		h.algorithm = algorithm
+	}
+}
+
+// 设置 argon2id 的参数, memory 单位为 KiB
+func WithArgon2Params(memory uint32, iterations uint32, parallelism uint8) PasswordOption {
+	return func(h *PasswordHasher) {
+		h.argon2Memory = memory
+		h.argon2Iterations = iterations
+		h.argon2Parallelism = parallelism
+	}
+}
+
+// 设置 bcrypt 的 cost
+func WithBcryptCost(cost int) PasswordOption {
+	return func(h *PasswordHasher) {
+		h.bcryptCost = cost
+	}
+}
+
+// 设置 PBKDF2 的迭代次数
+func WithPBKDF2Iterations(iterations int) PasswordOption {
+	return func(h *PasswordHasher) {
+		h.pbkdf2Iterations = iterations
+	}
+}
+
+// 创建口令哈希, 算法不支持或参数超出范围时返回错误
+func NewPasswordHasher(opts ...PasswordOption) (*PasswordHasher, error) {
+	h := &PasswordHasher{
+		algorithm:         PASSWORD_ARGON2ID,
+		argon2Memory:      DEFAULT_ARGON2_MEMORY,
+		argon2Iterations:  DEFAULT_ARGON2_ITERATIONS,
+		argon2Parallelism: DEFAULT_ARGON2_PARALLELISM,
+		bcryptCost:        DEFAULT_BCRYPT_COST,
+		pbkdf2Iterations:  DEFAULT_PBKDF2_ITERATIONS,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// 校验参数, 范围与校验哈希时的上限一致, argon2id 的 memory 至少为 8*parallelism
+func (h *PasswordHasher) validate() error {
+	switch h.algorithm {
+	case PASSWORD_ARGON2ID, PASSWORD_BCRYPT, PASSWORD_PBKDF2_SHA256, PASSWORD_PBKDF2_SHA512:
+	default:
+		return fmt.Errorf("invalid password algorithm: %s", h.algorithm)
+	}
+	if h.argon2Iterations == 0 || h.argon2Iterations > MAX_ARGON2_ITERATIONS {
+		return fmt.Errorf("invalid argon2 iterations: %d", h.argon2Iterations)
+	}
+	if h.argon2Parallelism == 0 || h.argon2Parallelism > MAX_ARGON2_PARALLELISM {
+		return fmt.Errorf("invalid argon2 parallelism: %d", h.argon2Parallelism)
+	}
+	if h.argon2Memory < 8*uint32(h.argon2Parallelism) || h.argon2Memory > MAX_ARGON2_MEMORY {
+		return fmt.Errorf("invalid argon2 memory: %d", h.argon2Memory)
+	}
+	if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("invalid bcrypt cost: %d", h.bcryptCost)
+	}
+	if h.pbkdf2Iterations <= 0 || h.pbkdf2Iterations > MAX_PBKDF2_ITERATIONS {
+		return fmt.Errorf("invalid pbkdf2 iterations: %d", h.pbkdf2Iterations)
+	}
+	return nil
+}
+
+// 使用默认配置计算口令的哈希
+func HashPassword(password string) (string, error) {
+	return defaultPasswordHasher.Hash(password)
+}
+
+// 校验口令, 不匹配时返回 ErrPasswordMismatch
+func VerifyPassword(password string, encodedHash string) error {
+	return defaultPasswordHasher.Verify(password, encodedHash)
+}
+
+// 计算口令的哈希, 每次使用随机的盐
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.algorithm {
+	case PASSWORD_ARGON2ID:
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		params := argon2Params{memory: h.argon2Memory, iterations: h.argon2Iterations, parallelism: h.argon2Parallelism}
+		key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, PASSWORD_KEY_SIZE)
+		return params.encode(salt, key), nil
+	case PASSWORD_BCRYPT:
+		encoded, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("bcrypt hash failed: %w", err)
+		}
+		return string(encoded), nil
+	case PASSWORD_PBKDF2_SHA256, PASSWORD_PBKDF2_SHA512:
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		params := pbkdf2Params{algorithm: h.algorithm, iterations: h.pbkdf2Iterations}
+		key, err := params.key(password, salt, PASSWORD_KEY_SIZE)
+		if err != nil {
+			return "", err
+		}
+		return params.encode(salt, key), nil
+	default:
+		return "", fmt.Errorf("invalid password algorithm: %s", h.algorithm)
+	}
+}
+
+// 校验口令, 使用常量时间比较, 不匹配时返回 ErrPasswordMismatch, 哈希格式不合法时返回 ErrInvalidHash
+func (h *PasswordHasher) Verify(password string, encodedHash string) error {
+	switch algorithm := hashAlgorithm(encodedHash); algorithm {
+	case PASSWORD_ARGON2ID:
+		params, salt, key, err := decodeArgon2(encodedHash)
+		if err != nil {
+			return err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		return comparePasswordKey(computed, key)
+	case PASSWORD_BCRYPT:
+		err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidHash, err)
+		}
+		return nil
+	case PASSWORD_PBKDF2_SHA256, PASSWORD_PBKDF2_SHA512:
+		params, salt, key, err := decodePBKDF2(algorithm, encodedHash)
+		if err != nil {
+			return err
+		}
+		computed, err := params.key(password, salt, len(key))
+		if err != nil {
+			return err
+		}
+		return comparePasswordKey(computed, key)
+	default:
+		return ErrInvalidHash
+	}
+}
+
+// 判断哈希结果是否需要按当前配置重新计算, 如算法不同、参数低于当前配置或格式不合法
+// 应在 Verify 成功后调用, 此时可用明文口令重新计算并保存
+func (h *PasswordHasher) NeedsRehash(encodedHash string) bool {
+	algorithm := hashAlgorithm(encodedHash)
+	if algorithm != h.algorithm {
+		return true
+	}
+
+	switch algorithm {
+	case PASSWORD_ARGON2ID:
+		params, _, key, err := decodeArgon2(encodedHash)
+		return err != nil || len(key) < PASSWORD_KEY_SIZE ||
+			params.memory < h.argon2Memory ||
+			params.iterations < h.argon2Iterations ||
+			params.parallelism < h.argon2Parallelism
+	case PASSWORD_BCRYPT:
+		cost, err := bcrypt.Cost([]byte(encodedHash))
+		return err != nil || cost < h.bcryptCost
+	default:
+		params, _, key, err := decodePBKDF2(algorithm, encodedHash)
+		return err != nil || len(key) < PASSWORD_KEY_SIZE || params.iterations < h.pbkdf2Iterations
+	}
+}
+
+// 根据哈希结果的前缀获取算法, 无法识别时返回空
+func hashAlgorithm(encodedHash string) string {
+	switch {
+	case strings.HasPrefix(encodedHash, "$"+PASSWORD_ARGON2ID+"$"):
+		return PASSWORD_ARGON2ID
+	case strings.HasPrefix(encodedHash, "$"+PASSWORD_PBKDF2_SHA256+"$"):
+		return PASSWORD_PBKDF2_SHA256
+	case strings.HasPrefix(encodedHash, "$"+PASSWORD_PBKDF2_SHA512+"$"):
+		return PASSWORD_PBKDF2_SHA512
+	case strings.HasPrefix(encodedHash, "$2a$"), strings.HasPrefix(encodedHash, "$2b$"), strings.HasPrefix(encodedHash, "$2y$"):
+		return PASSWORD_BCRYPT
+	default:
+		return ""
+	}
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func (p argon2Params) encode(salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", PASSWORD_ARGON2ID, argon2.Version,
+		p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// 解析 $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func decodeArgon2(encodedHash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if params.memory == 0 || params.memory > MAX_ARGON2_MEMORY ||
+		params.iterations == 0 || params.iterations > MAX_ARGON2_ITERATIONS ||
+		params.parallelism == 0 || params.parallelism > MAX_ARGON2_PARALLELISM {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, key, err := decodeSaltAndKey(parts[4], parts[5])
+	return params, salt, key, err
+}
+
+type pbkdf2Params struct {
+	algorithm  string
+	iterations int
+}
+
+func (p pbkdf2Params) key(password string, salt []byte, keyLength int) ([]byte, error) {
+	var newHash func() hash.Hash
+	if p.algorithm == PASSWORD_PBKDF2_SHA512 {
+		newHash = sha512.New
+	} else {
+		newHash = sha256.New
+	}
+	key, err := pbkdf2.Key(newHash, password, salt, p.iterations, keyLength)
+	if err != nil {
+		return nil, fmt.Errorf("pbkdf2 hash failed: %w", err)
+	}
+	return key, nil
+}
+
+func (p pbkdf2Params) encode(salt []byte, key []byte) string {
+	return fmt.Sprintf("$%s$i=%d$%s$%s", p.algorithm, p.iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// 解析 $pbkdf2-sha256$i=600000$<salt>$<hash>
+func decodePBKDF2(algorithm string, encodedHash string) (pbkdf2Params, []byte, []byte, error) {
+	params := pbkdf2Params{algorithm: algorithm}
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 5 || !strings.HasPrefix(parts[2], "i=") {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	iterations, err := strconv.Atoi(strings.TrimPrefix(parts[2], "i="))
+	if err != nil || iterations <= 0 || iterations > MAX_PBKDF2_ITERATIONS {
+		return params, nil, nil, ErrInvalidHash
+	}
+	params.iterations = iterations
+
+	salt, key, err := decodeSaltAndKey(parts[3], parts[4])
+	return params, salt, key, err
+}
+
+func decodeSaltAndKey(encodedSalt string, encodedKey string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) == 0 {
+		return nil, nil, ErrInvalidHash
+	}
+	return salt, key, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, PASSWORD_SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt failed: %w", err)
+	}
+	return salt, nil
+}
+
+func comparePasswordKey(computed []byte, key []byte) error {
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
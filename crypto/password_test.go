@@ -0,0 +1,148 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	Convey("test password hasher\n", t, func() {
+		password := "correct horse battery staple"
+		newHasher := func(opts ...PasswordOption) *PasswordHasher {
+			h, err := NewPasswordHasher(opts...)
+			So(err, ShouldBeNil)
+			return h
+		}
+
+		Convey("argon2id\n", func() {
+			h := newHasher(WithArgon2Params(1024, 1, 1))
+			encoded, err := h.Hash(password)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldStartWith, "$argon2id$v=19$m=1024,t=1,p=1$")
+
+			So(h.Verify(password, encoded), ShouldBeNil)
+			So(h.Verify(password+"!", encoded), ShouldEqual, ErrPasswordMismatch)
+			So(h.NeedsRehash(encoded), ShouldBeFalse)
+
+			another, _ := h.Hash(password)
+			So(another, ShouldNotEqual, encoded)
+
+			stronger := newHasher(WithArgon2Params(2048, 1, 1))
+			So(stronger.Verify(password, encoded), ShouldBeNil)
+			So(stronger.NeedsRehash(encoded), ShouldBeTrue)
+		})
+
+		Convey("bcrypt\n", func() {
+			h := newHasher(WithPasswordAlgorithm(PASSWORD_BCRYPT), WithBcryptCost(bcrypt.MinCost))
+			encoded, err := h.Hash(password)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldStartWith, "$2a$04$")
+
+			So(h.Verify(password, encoded), ShouldBeNil)
+			So(h.Verify(password+"!", encoded), ShouldEqual, ErrPasswordMismatch)
+			So(h.NeedsRehash(encoded), ShouldBeFalse)
+			So(newHasher(WithPasswordAlgorithm(PASSWORD_BCRYPT), WithBcryptCost(5)).NeedsRehash(encoded), ShouldBeTrue)
+
+			_, err = h.Hash(strings.Repeat("a", 73))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("pbkdf2 matches the RFC 7914 test vector\n", func() {
+			key, _ := hex.DecodeString("120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b")
+			encoded := "$pbkdf2-sha256$i=1$" + base64.RawStdEncoding.EncodeToString([]byte("salt")) + "$" +
+				base64.RawStdEncoding.EncodeToString(key)
+
+			h := newHasher(WithPasswordAlgorithm(PASSWORD_PBKDF2_SHA256), WithPBKDF2Iterations(1000))
+			So(h.Verify("password", encoded), ShouldBeNil)
+			So(h.Verify("passw0rd", encoded), ShouldEqual, ErrPasswordMismatch)
+			So(h.NeedsRehash(encoded), ShouldBeTrue)
+
+			encoded, err := h.Hash(password)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldStartWith, "$pbkdf2-sha256$i=1000$")
+			So(h.Verify(password, encoded), ShouldBeNil)
+			So(h.NeedsRehash(encoded), ShouldBeFalse)
+
+			sha512 := newHasher(WithPasswordAlgorithm(PASSWORD_PBKDF2_SHA512), WithPBKDF2Iterations(1000))
+			So(sha512.NeedsRehash(encoded), ShouldBeTrue)
+			encoded, err = sha512.Hash(password)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldStartWith, "$pbkdf2-sha512$i=1000$")
+			So(h.Verify(password, encoded), ShouldBeNil)
+		})
+
+		Convey("verify hashes from another algorithm\n", func() {
+			encoded, err := newHasher(WithArgon2Params(1024, 1, 1)).Hash(password)
+			So(err, ShouldBeNil)
+
+			h := newHasher(WithPasswordAlgorithm(PASSWORD_BCRYPT), WithBcryptCost(bcrypt.MinCost))
+			So(h.Verify(password, encoded), ShouldBeNil)
+			So(h.NeedsRehash(encoded), ShouldBeTrue)
+		})
+
+		Convey("invalid hashes\n", func() {
+			h := newHasher()
+			for _, encoded := range []string{
+				"",
+				"5f4dcc3b5aa765d61d8327deb882cf99",
+				"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+				"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$aGFzaA",
+				"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+				"$pbkdf2-sha256$i=0$c2FsdA$aGFzaA",
+				"$pbkdf2-sha256$i=1$!!$aGFzaA",
+				"$2a$04$short",
+			} {
+				So(h.Verify(password, encoded), ShouldNotBeNil)
+				So(h.Verify(password, encoded), ShouldNotEqual, ErrPasswordMismatch)
+				So(h.NeedsRehash(encoded), ShouldBeTrue)
+			}
+		})
+
+		Convey("invalid options are rejected at construction\n", func() {
+			for _, opts := range [][]PasswordOption{
+				{WithPasswordAlgorithm("md5")},
+				{WithArgon2Params(1024, 1, 0)},
+				{WithArgon2Params(1024, 0, 1)},
+				{WithArgon2Params(0, 1, 1)},
+				{WithArgon2Params(16, 1, 4)},
+				{WithArgon2Params(MAX_ARGON2_MEMORY+1, 1, 1)},
+				{WithBcryptCost(0)},
+				{WithPBKDF2Iterations(0)},
+				{WithPBKDF2Iterations(-1)},
+				{WithPBKDF2Iterations(MAX_PBKDF2_ITERATIONS + 1)},
+			} {
+				h, err := NewPasswordHasher(opts...)
+				So(err, ShouldNotBeNil)
+				So(h, ShouldBeNil)
+			}
+		})
+
+		Convey("parameters over the limits are rejected before hashing\n", func() {
+			h := newHasher()
+			for _, encoded := range []string{
+				"$argon2id$v=19$m=1048577,t=1,p=1$c2FsdA$aGFzaA",
+				"$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdA$aGFzaA",
+				"$argon2id$v=19$m=1024,t=65,p=1$c2FsdA$aGFzaA",
+				"$argon2id$v=19$m=1024,t=1,p=65$c2FsdA$aGFzaA",
+				"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+				"$pbkdf2-sha256$i=10000001$c2FsdA$aGFzaA",
+				"$pbkdf2-sha512$i=9223372036854775807$c2FsdA$aGFzaA",
+			} {
+				So(errors.Is(h.Verify(password, encoded), ErrInvalidHash), ShouldBeTrue)
+			}
+		})
+
+		Convey("package functions use argon2id\n", func() {
+			encoded, err := HashPassword(password)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldStartWith, "$argon2id$v=19$m=65536,t=3,p=4$")
+			So(VerifyPassword(password, encoded), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRSACipher(t *testing.T) {
+	priKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priKey)}))
+	pkcs8Bytes, _ := x509.MarshalPKCS8PrivateKey(priKey)
+	pkcs8 := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes}))
+	pkixBytes, _ := x509.MarshalPKIXPublicKey(&priKey.PublicKey)
+	pkixPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkixBytes}))
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &priKey.PublicKey, priKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}))
+
+	Convey("test RSA cipher\n", t, func() {
+		ctx := context.Background()
+
+		Convey("OAEP round trip with chunking\n", func() {
+			encryptor := NewRSACipherV2("", cert)
+			decryptor := NewRSACipherV2(pkcs8, "")
+
+			// 5 段, 每段最多 k - 2*hLen - 2 字节
+			data := strings.Repeat("a", 5*(priKey.Size()-2*32-2))
+			encrypted, err := encryptor.Encrypt(ctx, data)
+			So(err, ShouldBeNil)
+			raw, _ := base64.StdEncoding.DecodeString(encrypted)
+			So(len(raw), ShouldEqual, 5*priKey.Size())
+
+			decrypted, err := decryptor.Decrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, data)
+
+			_, err = encryptor.Decrypt(ctx, encrypted)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("OAEP with SHA1\n", func() {
+			ci := NewRSACipherV2(pkcs1, pkixPEM, WithRSAOAEPHash(crypto.SHA1))
+			encrypted, err := ci.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			decrypted, err := ci.Decrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("PKCS1v15 signature is compatible with the bare PKCS#1 key\n", func() {
+			body := strings.TrimSuffix(strings.TrimPrefix(pkcs1, PEM_BEGIN), PEM_END+"\n")
+			signature, err := NewRSACipherV2(body, "").Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+
+			verifier := NewRSACipherV2("", pkixPEM)
+			So(verifier.Verify(ctx, ODATA, signature), ShouldBeNil)
+			So(verifier.Verify(ctx, "other", signature), ShouldEqual, ErrSignatureMismatch)
+		})
+
+		Convey("PSS signature\n", func() {
+			ci := NewRSACipherV2(pkcs8, "", WithRSASignature(RSA_SIGN_PSS, crypto.SHA512))
+			signature, err := ci.Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(ci.Verify(ctx, ODATA, signature), ShouldBeNil)
+
+			pkcs1Signature, err := NewRSACipherV2(pkcs8, "").Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(ci.Verify(ctx, ODATA, pkcs1Signature), ShouldEqual, ErrSignatureMismatch)
+		})
+
+		Convey("invalid keys\n", func() {
+			ci := NewRSACipherV2("invalid", "invalid")
+			_, err := ci.Signature(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+			_, err = ci.Encrypt(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+			So(NewRSACipher("invalid", "").Signature(ODATA), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,215 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/x509"
+)
+
+const (
+	// SM2 密文格式, C1 为随机点, C2 为密文, C3 为 SM3 摘要
+	SM2_CIPHER_C1C3C2 = "C1C3C2" // GM/T 0003-2012 新标准, 默认
+	SM2_CIPHER_C1C2C3 = "C1C2C3" // 旧标准
+	SM2_CIPHER_ASN1   = "ASN1"   // GM/T 0009 的 ASN.1 编码
+
+	// C1 为 0x04 + 64 字节的点坐标, C3 为 32 字节
+	sm2C1Size = 65
+	sm2C3Size = 32
+)
+
+// SM2 加解密和签名, 密文和签名为 base64 编码
+// 签名使用默认的用户ID 1234567812345678 和 SM3 摘要, 编码为 ASN.1 DER
+type sm2Cipher struct {
+	priKey    *sm2.PrivateKey
+	priKeyErr error
+	pubKey    *sm2.PublicKey
+	pubKeyErr error
+
+	cipherFormat string
+}
+
+// SM2 的可选配置
+type SM2Option func(ci *sm2Cipher)
+
+// 设置密文格式, 默认为 C1C3C2
+func WithSM2CipherFormat(format string) SM2Option {
+	return func(ci *sm2Cipher) {
+		ci.cipherFormat = format
+	}
+}
+
+// 创建 SM2 加解密
+// 私钥支持 PKCS#8 PEM 和 hex 编码的 D, 公钥支持 PKIX PEM 和 hex 编码的 04 + X + Y
+// 只用于加密和校验签名时私钥可为空, 公钥为空时使用私钥中的公钥
+func NewSM2Cipher(privateKey string, publicKey string, opts ...SM2Option) VerifiableCipher {
+	ci := &sm2Cipher{
+		cipherFormat: SM2_CIPHER_C1C3C2,
+	}
+	for _, opt := range opts {
+		opt(ci)
+	}
+
+	if privateKey != "" {
+		ci.priKey, ci.priKeyErr = parseSM2PrivateKey(privateKey)
+	} else {
+		ci.priKeyErr = errors.New("SM2 private key is empty")
+	}
+
+	switch {
+	case publicKey != "":
+		ci.pubKey, ci.pubKeyErr = parseSM2PublicKey(publicKey)
+	case ci.priKey != nil:
+		ci.pubKey = &ci.priKey.PublicKey
+	default:
+		ci.pubKeyErr = errors.New("SM2 public key is empty")
+	}
+	return ci
+}
+
+func (ci sm2Cipher) Encrypt(ctx context.Context, data string) (string, error) {
+	if ci.pubKeyErr != nil {
+		return "", ci.pubKeyErr
+	}
+
+	var (
+		encrypted []byte
+		err       error
+	)
+	switch ci.cipherFormat {
+	case SM2_CIPHER_C1C3C2:
+		encrypted, err = sm2.Encrypt(ci.pubKey, []byte(data), rand.Reader, sm2.C1C3C2)
+	case SM2_CIPHER_C1C2C3:
+		encrypted, err = sm2.Encrypt(ci.pubKey, []byte(data), rand.Reader, sm2.C1C2C3)
+	case SM2_CIPHER_ASN1:
+		encrypted, err = sm2.EncryptAsn1(ci.pubKey, []byte(data), rand.Reader)
+	default:
+		return "", fmt.Errorf("invalid SM2 cipher format: %s", ci.cipherFormat)
+	}
+	if err != nil {
+		return "", fmt.Errorf("SM2 encrypt failed: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// 解密, C1 缺少 0x04 前缀的密文也可以解密
+func (ci sm2Cipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	if ci.priKeyErr != nil {
+		return "", ci.priKeyErr
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode SM2 ciphertext failed: %w", err)
+	}
+
+	mode := sm2.C1C3C2
+	switch ci.cipherFormat {
+	case SM2_CIPHER_C1C3C2:
+	case SM2_CIPHER_C1C2C3:
+		mode = sm2.C1C2C3
+	case SM2_CIPHER_ASN1:
+		if encrypted, err = sm2.CipherUnmarshal(encrypted); err != nil {
+			return "", fmt.Errorf("unmarshal SM2 ciphertext failed: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("invalid SM2 cipher format: %s", ci.cipherFormat)
+	}
+
+	if encrypted, err = ci.normalizeC1(encrypted); err != nil {
+		return "", err
+	}
+	decrypted, err := sm2.Decrypt(ci.priKey, encrypted, mode)
+	if err != nil {
+		return "", fmt.Errorf("SM2 decrypt failed: %w", err)
+	}
+	return string(decrypted), nil
+}
+
+// 检查密文长度和 C1 是否在曲线上, 避免畸形密文导致 panic
+func (ci sm2Cipher) normalizeC1(encrypted []byte) ([]byte, error) {
+	if len(encrypted) > 0 && encrypted[0] == 0x04 && len(encrypted) >= sm2C1Size+sm2C3Size && ci.onCurve(encrypted[1:sm2C1Size]) {
+		return encrypted, nil
+	}
+	if len(encrypted) >= sm2C1Size-1+sm2C3Size && ci.onCurve(encrypted[:sm2C1Size-1]) {
+		return append([]byte{0x04}, encrypted...), nil
+	}
+	return nil, ErrInvalidCiphertext
+}
+
+func (ci sm2Cipher) onCurve(point []byte) bool {
+	x := new(big.Int).SetBytes(point[:32])
+	y := new(big.Int).SetBytes(point[32:64])
+	return sm2.P256Sm2().IsOnCurve(x, y)
+}
+
+func (ci sm2Cipher) Signature(ctx context.Context, signContent string) (string, error) {
+	if ci.priKeyErr != nil {
+		return "", ci.priKeyErr
+	}
+	signature, err := ci.priKey.Sign(rand.Reader, []byte(signContent), nil)
+	if err != nil {
+		return "", fmt.Errorf("SM2 sign failed: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+func (ci sm2Cipher) Verify(ctx context.Context, signContent string, signature string) error {
+	if ci.pubKeyErr != nil {
+		return ci.pubKeyErr
+	}
+	decodedSign, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("decode SM2 signature failed: %w", err)
+	}
+	if !ci.pubKey.Verify([]byte(signContent), decodedSign) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func parseSM2PrivateKey(privateKey string) (*sm2.PrivateKey, error) {
+	if block, _ := pem.Decode([]byte(privateKey)); block != nil {
+		priKey, err := x509.ParsePKCS8UnecryptedPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse SM2 private key failed: %w", err)
+		}
+		return priKey, nil
+	}
+
+	// D 的 hex 编码可能省略了前导 0
+	dHex := strings.TrimSpace(privateKey)
+	if len(dHex) < 64 {
+		dHex = strings.Repeat("0", 64-len(dHex)) + dHex
+	}
+	priKey, err := x509.ReadPrivateKeyFromHex(dHex)
+	if err != nil {
+		return nil, fmt.Errorf("parse SM2 private key failed: %w", err)
+	}
+	return priKey, nil
+}
+
+func parseSM2PublicKey(publicKey string) (*sm2.PublicKey, error) {
+	var (
+		pubKey *sm2.PublicKey
+		err    error
+	)
+	if block, _ := pem.Decode([]byte(publicKey)); block != nil {
+		pubKey, err = x509.ParseSm2PublicKey(block.Bytes)
+	} else {
+		pubKey, err = x509.ReadPublicKeyFromHex(strings.TrimSpace(publicKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse SM2 public key failed: %w", err)
+	}
+	if !pubKey.Curve.IsOnCurve(pubKey.X, pubKey.Y) {
+		return nil, errors.New("SM2 public key is not on curve")
+	}
+	return pubKey, nil
+}
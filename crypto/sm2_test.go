@@ -0,0 +1,75 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/x509"
+)
+
+func TestSM2(t *testing.T) {
+	priKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priPEM, err := x509.WritePrivateKeyToPem(priKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := x509.WritePublicKeyToPem(&priKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priHex := x509.WritePrivateKeyToHex(priKey)
+	pubHex := x509.WritePublicKeyToHex(&priKey.PublicKey)
+
+	Convey("test SM2\n", t, func() {
+		ctx := context.Background()
+
+		for _, format := range []string{SM2_CIPHER_C1C3C2, SM2_CIPHER_C1C2C3, SM2_CIPHER_ASN1} {
+			Convey("encrypt and decrypt in "+format+"\n", func() {
+				encryptor := NewSM2Cipher("", pubHex, WithSM2CipherFormat(format))
+				decryptor := NewSM2Cipher(string(priPEM), "", WithSM2CipherFormat(format))
+
+				encrypted, err := encryptor.Encrypt(ctx, ODATA)
+				So(err, ShouldBeNil)
+				decrypted, err := decryptor.Decrypt(ctx, encrypted)
+				So(err, ShouldBeNil)
+				So(decrypted, ShouldEqual, ODATA)
+			})
+		}
+
+		Convey("decrypt ciphertext without 0x04 prefix\n", func() {
+			ci := NewSM2Cipher(priHex, string(pubPEM))
+			encrypted, err := ci.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			raw, _ := base64.StdEncoding.DecodeString(encrypted)
+
+			decrypted, err := ci.Decrypt(ctx, base64.StdEncoding.EncodeToString(raw[1:]))
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("sign and verify\n", func() {
+			signature, err := NewSM2Cipher(priHex, "").Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+
+			verifier := NewSM2Cipher("", string(pubPEM))
+			So(verifier.Verify(ctx, ODATA, signature), ShouldBeNil)
+			So(verifier.Verify(ctx, "other", signature), ShouldEqual, ErrSignatureMismatch)
+		})
+
+		Convey("malformed input\n", func() {
+			ci := NewSM2Cipher(priHex, "")
+			_, err := ci.Decrypt(ctx, base64.StdEncoding.EncodeToString([]byte("short")))
+			So(err, ShouldEqual, ErrInvalidCiphertext)
+
+			_, err = NewSM2Cipher("", "invalid").Encrypt(ctx, ODATA)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
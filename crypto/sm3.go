@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+// 计算 SM3 摘要, 返回小写的 hex 编码
+func SM3Hex(data []byte) string {
+	return hex.EncodeToString(sm3.Sm3Sum(data))
+}
+
+// 计算 HMAC-SM3, 返回小写的 hex 编码
+func HMACSM3Hex(key []byte, data []byte) string {
+	h := hmac.New(sm3.New, key)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SM3 签名, key 不为空时为 HMAC-SM3, 否则为 SM3 摘要, 签名为小写的 hex 编码
+type sm3Cipher struct {
+	key []byte
+}
+
+func NewSM3Cipher(key []byte) VerifiableCipher {
+	return &sm3Cipher{
+		key: key,
+	}
+}
+
+func (ci sm3Cipher) Encrypt(ctx context.Context, data string) (string, error) {
+	return "", fmt.Errorf("sm3Cipher Encrypt: %w", ErrNotImplemented)
+}
+
+func (ci sm3Cipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	return "", fmt.Errorf("sm3Cipher Decrypt: %w", ErrNotImplemented)
+}
+
+func (ci sm3Cipher) Signature(ctx context.Context, signContent string) (string, error) {
+	if len(ci.key) == 0 {
+		return SM3Hex([]byte(signContent)), nil
+	}
+	return HMACSM3Hex(ci.key, []byte(signContent)), nil
+}
+
+// 校验签名, 使用常量时间比较
+func (ci sm3Cipher) Verify(ctx context.Context, signContent string, signature string) error {
+	expected, _ := ci.Signature(ctx, signContent)
+	decodedSign, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrSignatureMismatch
+	}
+	expectedSign, _ := hex.DecodeString(expected)
+	if !hmac.Equal(expectedSign, decodedSign) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
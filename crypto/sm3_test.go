@@ -0,0 +1,32 @@
+package crypto
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSM3(t *testing.T) {
+	Convey("test SM3\n", t, func() {
+		ctx := context.Background()
+
+		Convey("digest\n", func() {
+			So(SM3Hex([]byte("abc")), ShouldEqual, "66c7f0f462eeedd9d1f2d46bdc10e4e24167c4875cf2f7a2297da02b8f4ba8e0")
+
+			signature, err := NewSM3Cipher(nil).Signature(ctx, "abc")
+			So(err, ShouldBeNil)
+			So(signature, ShouldEqual, SM3Hex([]byte("abc")))
+		})
+
+		Convey("hmac\n", func() {
+			ci := NewSM3Cipher([]byte(KEY))
+			signature, err := ci.Signature(ctx, ODATA)
+			So(err, ShouldBeNil)
+			So(signature, ShouldEqual, HMACSM3Hex([]byte(KEY), []byte(ODATA)))
+			So(ci.Verify(ctx, ODATA, signature), ShouldBeNil)
+			So(ci.Verify(ctx, "other", signature), ShouldEqual, ErrSignatureMismatch)
+			So(ci.Verify(ctx, ODATA, "not hex"), ShouldEqual, ErrSignatureMismatch)
+		})
+	})
+}
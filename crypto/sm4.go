@@ -0,0 +1,258 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+const (
+	// SM4 加密模式
+	SM4_MODE_ECB = "ECB"
+	SM4_MODE_CBC = "CBC"
+	SM4_MODE_GCM = "GCM"
+
+	SM4_KEY_SIZE = 16
+)
+
+// SM4 加解密, 密文为 base64 编码
+// ECB、CBC 使用 PKCS#7 填充, CBC 的密文为 IV + 密文, 设置固定 IV 时只有密文
+// GCM 的密文为 nonce + 密文 + tag, 与 RFC 8998 和常见国密工具一致
+type sm4Cipher struct {
+	mode  string
+	block cipher.Block
+	aead  cipher.AEAD
+	iv    []byte
+	aad   []byte
+}
+
+// SM4 的可选配置
+type SM4Option func(ci *sm4Cipher)
+
+// CBC 模式使用固定 IV, 密文中不包含 IV, 用于与单独传递 IV 的系统对接
+func WithSM4IV(iv []byte) SM4Option {
+	return func(ci *sm4Cipher) {
+		ci.iv = iv
+	}
+}
+
+// 设置 GCM 模式默认的附加数据, Encrypt 和 Decrypt 使用
+func WithSM4AAD(aad []byte) SM4Option {
+	return func(ci *sm4Cipher) {
+		ci.aad = aad
+	}
+}
+
+// 创建 SM4 加解密, key 为 16 字节
+func NewSM4Cipher(key []byte, mode string, opts ...SM4Option) (AEADCipher, error) {
+	if len(key) != SM4_KEY_SIZE {
+		return nil, fmt.Errorf("invalid SM4 key size %d, expected %d", len(key), SM4_KEY_SIZE)
+	}
+
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create SM4 cipher failed: %w", err)
+	}
+
+	ci := &sm4Cipher{
+		mode:  mode,
+		block: block,
+	}
+	for _, opt := range opts {
+		opt(ci)
+	}
+
+	switch mode {
+	case SM4_MODE_ECB:
+	case SM4_MODE_CBC:
+		if ci.iv != nil && len(ci.iv) != block.BlockSize() {
+			return nil, fmt.Errorf("invalid SM4 iv size %d, expected %d", len(ci.iv), block.BlockSize())
+		}
+	case SM4_MODE_GCM:
+		ci.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("create SM4-GCM failed: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid SM4 cipher mode: %s", mode)
+	}
+	return ci, nil
+}
+
+func (ci sm4Cipher) Encrypt(ctx context.Context, data string) (string, error) {
+	var (
+		encrypted []byte
+		err       error
+	)
+	switch ci.mode {
+	case SM4_MODE_ECB:
+		encrypted = ci.encryptECB([]byte(data))
+	case SM4_MODE_CBC:
+		encrypted, err = ci.encryptCBC([]byte(data))
+	case SM4_MODE_GCM:
+		encrypted, err = ci.encryptGCM([]byte(data), ci.aad)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (ci sm4Cipher) Decrypt(ctx context.Context, encryptedData string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode SM4 ciphertext failed: %w", err)
+	}
+
+	var decrypted []byte
+	switch ci.mode {
+	case SM4_MODE_ECB:
+		decrypted, err = ci.decryptECB(encrypted)
+	case SM4_MODE_CBC:
+		decrypted, err = ci.decryptCBC(encrypted)
+	case SM4_MODE_GCM:
+		decrypted, err = ci.decryptGCM(encrypted, ci.aad)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
+
+func (ci sm4Cipher) EncryptWithAAD(ctx context.Context, data string, aad []byte) (string, error) {
+	if ci.aead == nil {
+		return "", fmt.Errorf("SM4 cipher mode %s does not support associated data", ci.mode)
+	}
+	encrypted, err := ci.encryptGCM([]byte(data), aad)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func (ci sm4Cipher) DecryptWithAAD(ctx context.Context, encryptedData string, aad []byte) (string, error) {
+	if ci.aead == nil {
+		return "", fmt.Errorf("SM4 cipher mode %s does not support associated data", ci.mode)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return "", fmt.Errorf("decode SM4 ciphertext failed: %w", err)
+	}
+	decrypted, err := ci.decryptGCM(encrypted, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
+
+func (ci sm4Cipher) Signature(ctx context.Context, signContent string) (string, error) {
+	return "", fmt.Errorf("sm4Cipher Signature: %w", ErrNotImplemented)
+}
+
+func (ci sm4Cipher) encryptECB(data []byte) []byte {
+	blockSize := ci.block.BlockSize()
+	plain := pkcs7Padding(data, blockSize)
+	encrypted := make([]byte, len(plain))
+	for bs := 0; bs < len(plain); bs += blockSize {
+		ci.block.Encrypt(encrypted[bs:bs+blockSize], plain[bs:bs+blockSize])
+	}
+	return encrypted
+}
+
+func (ci sm4Cipher) decryptECB(encrypted []byte) ([]byte, error) {
+	blockSize := ci.block.BlockSize()
+	if len(encrypted) == 0 || len(encrypted)%blockSize != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	decrypted := make([]byte, len(encrypted))
+	for bs := 0; bs < len(encrypted); bs += blockSize {
+		ci.block.Decrypt(decrypted[bs:bs+blockSize], encrypted[bs:bs+blockSize])
+	}
+	return pkcs7UnPadding(decrypted, blockSize)
+}
+
+func (ci sm4Cipher) encryptCBC(data []byte) ([]byte, error) {
+	blockSize := ci.block.BlockSize()
+	iv := ci.iv
+	if iv == nil {
+		iv = make([]byte, blockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, fmt.Errorf("generate SM4 iv failed: %w", err)
+		}
+	}
+
+	plain := pkcs7Padding(data, blockSize)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(ci.block, iv).CryptBlocks(encrypted, plain)
+	if ci.iv != nil {
+		return encrypted, nil
+	}
+	return append(iv, encrypted...), nil
+}
+
+func (ci sm4Cipher) decryptCBC(encrypted []byte) ([]byte, error) {
+	blockSize := ci.block.BlockSize()
+	iv := ci.iv
+	if iv == nil {
+		if len(encrypted) < blockSize {
+			return nil, ErrInvalidCiphertext
+		}
+		iv, encrypted = encrypted[:blockSize], encrypted[blockSize:]
+	}
+	if len(encrypted) == 0 || len(encrypted)%blockSize != 0 {
+		return nil, ErrInvalidCiphertext
+	}
+
+	decrypted := make([]byte, len(encrypted))
+	cipher.NewCBCDecrypter(ci.block, iv).CryptBlocks(decrypted, encrypted)
+	return pkcs7UnPadding(decrypted, blockSize)
+}
+
+func (ci sm4Cipher) encryptGCM(data []byte, aad []byte) ([]byte, error) {
+	nonce := make([]byte, ci.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate SM4-GCM nonce failed: %w", err)
+	}
+	return ci.aead.Seal(nonce, nonce, data, aad), nil
+}
+
+func (ci sm4Cipher) decryptGCM(encrypted []byte, aad []byte) ([]byte, error) {
+	nonceSize := ci.aead.NonceSize()
+	if len(encrypted) < nonceSize+ci.aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	decrypted, err := ci.aead.Open(nil, encrypted[:nonceSize], encrypted[nonceSize:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("SM4-GCM authentication failed: %w", err)
+	}
+	return decrypted, nil
+}
+
+// PKCS#7 填充
+func pkcs7Padding(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+}
+
+// PKCS#7 去除填充
+func pkcs7UnPadding(data []byte, blockSize int) ([]byte, error) {
+	length := len(data)
+	if length == 0 {
+		return nil, ErrInvalidPadding
+	}
+	padding := int(data[length-1])
+	if padding == 0 || padding > blockSize || padding > length {
+		return nil, ErrInvalidPadding
+	}
+	for _, b := range data[length-padding:] {
+		if int(b) != padding {
+			return nil, ErrInvalidPadding
+		}
+	}
+	return data[:length-padding], nil
+}
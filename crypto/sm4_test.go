@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSM4(t *testing.T) {
+	Convey("test SM4\n", t, func() {
+		ctx := context.Background()
+		key, _ := hex.DecodeString("0123456789abcdeffedcba9876543210")
+
+		Convey("ECB matches the GB/T 32907 test vector\n", func() {
+			ci, err := NewSM4Cipher(key, SM4_MODE_ECB)
+			So(err, ShouldBeNil)
+
+			encrypted, err := ci.Encrypt(ctx, string(key))
+			So(err, ShouldBeNil)
+			raw, _ := base64.StdEncoding.DecodeString(encrypted)
+			So(hex.EncodeToString(raw[:16]), ShouldEqual, "681edf34d206965e86b3e94f536e4246")
+
+			decrypted, err := ci.Decrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, string(key))
+		})
+
+		Convey("CBC with random and fixed iv\n", func() {
+			ci, err := NewSM4Cipher(key, SM4_MODE_CBC)
+			So(err, ShouldBeNil)
+			encrypted, err := ci.Encrypt(ctx, ODATA)
+			So(err, ShouldBeNil)
+			decrypted, err := ci.Decrypt(ctx, encrypted)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			fixed, err := NewSM4Cipher(key, SM4_MODE_CBC, WithSM4IV(key))
+			So(err, ShouldBeNil)
+			first, _ := fixed.Encrypt(ctx, ODATA)
+			second, _ := fixed.Encrypt(ctx, ODATA)
+			So(first, ShouldEqual, second)
+			decrypted, err = fixed.Decrypt(ctx, first)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+		})
+
+		Convey("GCM with associated data\n", func() {
+			ci, err := NewSM4Cipher(key, SM4_MODE_GCM)
+			So(err, ShouldBeNil)
+			encrypted, err := ci.EncryptWithAAD(ctx, ODATA, []byte("row-1"))
+			So(err, ShouldBeNil)
+
+			decrypted, err := ci.DecryptWithAAD(ctx, encrypted, []byte("row-1"))
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, ODATA)
+
+			_, err = ci.DecryptWithAAD(ctx, encrypted, []byte("row-2"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("malformed input\n", func() {
+			ci, err := NewSM4Cipher(key, SM4_MODE_ECB)
+			So(err, ShouldBeNil)
+			_, err = ci.Decrypt(ctx, base64.StdEncoding.EncodeToString([]byte("short")))
+			So(err, ShouldEqual, ErrInvalidCiphertext)
+			_, err = ci.EncryptWithAAD(ctx, ODATA, nil)
+			So(err, ShouldNotBeNil)
+
+			_, err = NewSM4Cipher([]byte(KEY), SM4_MODE_ECB)
+			So(err, ShouldNotBeNil)
+			_, err = NewSM4Cipher(key, "CTR")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
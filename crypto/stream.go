@@ -0,0 +1,337 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	// 流式加密格式的版本
+	// 格式为 头 + 若干分段, 头为 版本 + 算法(1字节) + 分段长度(4字节) + nonce 前缀(7字节) + 包装后的数据密钥长度(2字节) + 包装后的数据密钥
+	// 每个分段为 明文分段的密文 + tag, 头作为每个分段的附加数据
+	// 分段的 nonce 为 nonce 前缀 + 分段序号(4字节) + 是否最后一段(1字节), 因此分段不能重排、删除, 流被截断时可以发现
+	STREAM_VERSION byte = 0x03
+
+	DEFAULT_STREAM_CHUNK_SIZE = 64 * 1024
+	MAX_STREAM_CHUNK_SIZE     = 16 * 1024 * 1024
+
+	streamNoncePrefixSize = 7
+	streamHeaderSize      = 1 + 1 + 4 + streamNoncePrefixSize + 2
+)
+
+var (
+	ErrStreamTruncated = errors.New("crypto: encrypted stream is truncated")
+	ErrStreamClosed    = errors.New("crypto: encrypted stream is closed")
+)
+
+// 流式加密的算法, 写入头中
+var streamAlgorithms = map[string]byte{
+	KEY_ALGORITHM_AES_256_GCM: 1,
+	KEY_ALGORITHM_SM4_GCM:     2,
+}
+
+// 流式加密的可选配置
+type StreamOption func(opts *streamOptions)
+
+type streamOptions struct {
+	chunkSize int
+}
+
+// 设置明文分段的长度, 默认为 DEFAULT_STREAM_CHUNK_SIZE, 最大为 MAX_STREAM_CHUNK_SIZE
+func WithStreamChunkSize(chunkSize int) StreamOption {
+	return func(opts *streamOptions) {
+		opts.chunkSize = chunkSize
+	}
+}
+
+// 创建加密流, 写入的数据分段加密后写入 w, 必须调用 Close 写入最后一段, Close 不会关闭 w
+// algorithm 为 KEY_ALGORITHM_AES_256_GCM 或 KEY_ALGORITHM_SM4_GCM, 同一个 key 可用于多个流
+func NewEncryptWriter(w io.Writer, algorithm string, key []byte, opts ...StreamOption) (io.WriteCloser, error) {
+	return newEncryptWriter(w, algorithm, key, nil, opts...)
+}
+
+// 创建解密流, 从 r 中读取 NewEncryptWriter 写入的数据并解密
+// 分段被篡改时返回错误, 流在最后一段之前结束时返回 ErrStreamTruncated
+func NewDecryptReader(r io.Reader, algorithm string, key []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, wrappedKey, err := readStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) > 0 {
+		return nil, errors.New("stream is encrypted with a keyring data key")
+	}
+	if streamAlgorithms[algorithm] != header[1] {
+		return nil, fmt.Errorf("stream algorithm mismatch, expected %s", algorithm)
+	}
+	return newDecryptReader(br, header, algorithm, key)
+}
+
+// 使用新的数据密钥创建加密流, 数据密钥由当前 active 主密钥包装后写入头中
+func (k *Keyring) NewEncryptWriter(w io.Writer, opts ...StreamOption) (io.WriteCloser, error) {
+	dataKey, wrappedKey, algorithm, err := k.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptWriter(w, algorithm, dataKey, wrappedKey, opts...)
+}
+
+// 创建解密流, 使用头中记录的主密钥解开数据密钥
+func (k *Keyring) NewDecryptReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, wrappedKey, err := readStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) == 0 {
+		return nil, errors.New("stream is not encrypted with a keyring data key")
+	}
+
+	dataKey, algorithm, err := k.UnwrapDataKey(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	if streamAlgorithms[algorithm] != header[1] {
+		return nil, fmt.Errorf("stream algorithm mismatch, expected %s", algorithm)
+	}
+	return newDecryptReader(br, header, algorithm, dataKey)
+}
+
+type encryptWriter struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix []byte
+	counter     uint64
+	chunkSize   int
+	buf         []byte
+	out         []byte
+	err         error
+}
+
+func newEncryptWriter(w io.Writer, algorithm string, key []byte, wrappedKey []byte, opts ...StreamOption) (io.WriteCloser, error) {
+	options := streamOptions{
+		chunkSize: DEFAULT_STREAM_CHUNK_SIZE,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.chunkSize <= 0 || options.chunkSize > MAX_STREAM_CHUNK_SIZE {
+		return nil, fmt.Errorf("invalid stream chunk size: %d", options.chunkSize)
+	}
+
+	algorithmID, ok := streamAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("invalid stream algorithm: %s", algorithm)
+	}
+	aead, err := newKeyAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, streamHeaderSize, streamHeaderSize+len(wrappedKey))
+	header[0] = STREAM_VERSION
+	header[1] = algorithmID
+	binary.BigEndian.PutUint32(header[2:6], uint32(options.chunkSize))
+	if _, err := rand.Read(header[6 : 6+streamNoncePrefixSize]); err != nil {
+		return nil, fmt.Errorf("generate nonce failed: %w", err)
+	}
+	binary.BigEndian.PutUint16(header[6+streamNoncePrefixSize:], uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("write stream header failed: %w", err)
+	}
+
+	return &encryptWriter{
+		w:           w,
+		aead:        aead,
+		header:      header,
+		noncePrefix: header[6 : 6+streamNoncePrefixSize],
+		chunkSize:   options.chunkSize,
+		buf:         make([]byte, 0, options.chunkSize),
+		out:         make([]byte, 0, options.chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// 缓存一个分段的明文, 超过分段长度时加密写入, 最后一段在 Close 时写入
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(ew.buf) == ew.chunkSize {
+			if err := ew.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(ew.buf[len(ew.buf):ew.chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// 加密写入最后一段, 可能为空
+func (ew *encryptWriter) Close() error {
+	if ew.err != nil {
+		if ew.err == ErrStreamClosed {
+			return nil
+		}
+		return ew.err
+	}
+	if err := ew.seal(true); err != nil {
+		return err
+	}
+	ew.err = ErrStreamClosed
+	return nil
+}
+
+func (ew *encryptWriter) seal(last bool) error {
+	nonce, err := streamNonce(ew.noncePrefix, ew.counter, last)
+	if err != nil {
+		ew.err = err
+		return err
+	}
+	ew.out = ew.aead.Seal(ew.out[:0], nonce, ew.buf, ew.header)
+	if _, err := ew.w.Write(ew.out); err != nil {
+		ew.err = fmt.Errorf("write stream chunk failed: %w", err)
+		return ew.err
+	}
+	ew.buf = ew.buf[:0]
+	ew.counter++
+	return nil
+}
+
+type decryptReader struct {
+	r           *bufio.Reader
+	aead        cipher.AEAD
+	header      []byte
+	noncePrefix []byte
+	counter     uint64
+	in          []byte
+	out         []byte
+	plain       []byte
+	done        bool
+	err         error
+}
+
+// 读取并校验头, 返回头和包装后的数据密钥
+func readStreamHeader(r io.Reader) ([]byte, []byte, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("read stream header failed: %w", err)
+	}
+	if header[0] != STREAM_VERSION {
+		return nil, nil, ErrInvalidCiphertext
+	}
+	chunkSize := binary.BigEndian.Uint32(header[2:6])
+	if chunkSize == 0 || chunkSize > MAX_STREAM_CHUNK_SIZE {
+		return nil, nil, ErrInvalidCiphertext
+	}
+
+	wrappedKey := make([]byte, binary.BigEndian.Uint16(header[6+streamNoncePrefixSize:]))
+	if _, err := io.ReadFull(r, wrappedKey); err != nil {
+		return nil, nil, fmt.Errorf("read stream header failed: %w", err)
+	}
+	return append(header, wrappedKey...), wrappedKey, nil
+}
+
+func newDecryptReader(r *bufio.Reader, header []byte, algorithm string, key []byte) (io.Reader, error) {
+	aead, err := newKeyAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize := int(binary.BigEndian.Uint32(header[2:6]))
+	return &decryptReader{
+		r:           r,
+		aead:        aead,
+		header:      header,
+		noncePrefix: header[6 : 6+streamNoncePrefixSize],
+		in:          make([]byte, chunkSize+aead.Overhead()),
+		out:         make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			dr.err = err
+			return 0, err
+		}
+	}
+
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+// 读取并解密一个分段, 分段不足长度或之后没有数据时为最后一段
+func (dr *decryptReader) open() error {
+	n, err := io.ReadFull(dr.r, dr.in)
+	last := false
+	switch {
+	case err == io.EOF:
+		return ErrStreamTruncated
+	case err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return fmt.Errorf("read stream chunk failed: %w", err)
+	default:
+		if _, peekErr := dr.r.Peek(1); peekErr == io.EOF {
+			last = true
+		} else if peekErr != nil {
+			return fmt.Errorf("read stream chunk failed: %w", peekErr)
+		}
+	}
+
+	nonce, err := streamNonce(dr.noncePrefix, dr.counter, last)
+	if err != nil {
+		return err
+	}
+	plain, err := dr.aead.Open(dr.out[:0], nonce, dr.in[:n], dr.header)
+	if err != nil {
+		// 流在中间的分段结束
+		if last {
+			nonce, _ = streamNonce(dr.noncePrefix, dr.counter, false)
+			if _, openErr := dr.aead.Open(dr.out[:0], nonce, dr.in[:n], dr.header); openErr == nil {
+				return ErrStreamTruncated
+			}
+		}
+		return fmt.Errorf("stream chunk %d authentication failed: %w", dr.counter, err)
+	}
+
+	dr.plain = plain
+	dr.done = last
+	dr.counter++
+	return nil
+}
+
+func streamNonce(prefix []byte, counter uint64, last bool) ([]byte, error) {
+	if counter > math.MaxUint32 {
+		return nil, errors.New("encrypted stream has too many chunks")
+	}
+	nonce := make([]byte, streamNoncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], uint32(counter))
+	if last {
+		nonce[streamNoncePrefixSize+4] = 1
+	}
+	return nonce, nil
+}
@@ -0,0 +1,153 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStream(t *testing.T) {
+	Convey("test encrypted stream\n", t, func() {
+		aesKey := bytes.Repeat([]byte{1}, AES_256_KEY_SIZE)
+		plain := make([]byte, 10*1024+7)
+		_, err := rand.Read(plain)
+		So(err, ShouldBeNil)
+
+		encrypt := func(data []byte, algorithm string, key []byte) []byte {
+			var buf bytes.Buffer
+			w, err := NewEncryptWriter(&buf, algorithm, key, WithStreamChunkSize(1024))
+			So(err, ShouldBeNil)
+			// 分多次写入, 与分段边界不对齐
+			for i := 0; i < len(data); i += 300 {
+				end := min(i+300, len(data))
+				n, err := w.Write(data[i:end])
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, end-i)
+			}
+			So(w.Close(), ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			_, err = w.Write([]byte("x"))
+			So(err, ShouldEqual, ErrStreamClosed)
+			return buf.Bytes()
+		}
+		decrypt := func(data []byte, algorithm string, key []byte) ([]byte, error) {
+			r, err := NewDecryptReader(bytes.NewReader(data), algorithm, key)
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(r)
+		}
+
+		Convey("AES-256-GCM and SM4-GCM round trip\n", func() {
+			for _, tc := range []struct {
+				algorithm string
+				key       []byte
+			}{
+				{KEY_ALGORITHM_AES_256_GCM, aesKey},
+				{KEY_ALGORITHM_SM4_GCM, bytes.Repeat([]byte{2}, SM4_KEY_SIZE)},
+			} {
+				for _, data := range [][]byte{plain, plain[:2048], {}} {
+					encrypted := encrypt(data, tc.algorithm, tc.key)
+					decrypted, err := decrypt(encrypted, tc.algorithm, tc.key)
+					So(err, ShouldBeNil)
+					So(bytes.Equal(decrypted, data), ShouldBeTrue)
+				}
+			}
+		})
+
+		Convey("detect truncation\n", func() {
+			encrypted := encrypt(plain, KEY_ALGORITHM_AES_256_GCM, aesKey)
+			chunk := 1024 + 16
+
+			// 在分段边界截断
+			_, err := decrypt(encrypted[:streamHeaderSize+3*chunk], KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldEqual, ErrStreamTruncated)
+			_, err = decrypt(encrypted[:streamHeaderSize], KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldEqual, ErrStreamTruncated)
+
+			// 在分段中间截断
+			_, err = decrypt(encrypted[:streamHeaderSize+3*chunk+100], KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+
+			// 空的流去掉最后一段
+			empty := encrypt(nil, KEY_ALGORITHM_AES_256_GCM, aesKey)
+			_, err = decrypt(empty[:streamHeaderSize], KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldEqual, ErrStreamTruncated)
+		})
+
+		Convey("detect tampering\n", func() {
+			encrypted := encrypt(plain, KEY_ALGORITHM_AES_256_GCM, aesKey)
+			chunk := 1024 + 16
+
+			tampered := bytes.Clone(encrypted)
+			tampered[streamHeaderSize+chunk+10] ^= 0xff
+			_, err := decrypt(tampered, KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+
+			// 交换分段
+			swapped := bytes.Clone(encrypted)
+			copy(swapped[streamHeaderSize:], encrypted[streamHeaderSize+chunk:streamHeaderSize+2*chunk])
+			copy(swapped[streamHeaderSize+chunk:], encrypted[streamHeaderSize:streamHeaderSize+chunk])
+			_, err = decrypt(swapped, KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+
+			// 修改头中的分段长度
+			header := bytes.Clone(encrypted)
+			header[5] ^= 0x01
+			_, err = decrypt(header, KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+
+			// 在最后一段之后追加数据
+			_, err = decrypt(append(bytes.Clone(encrypted), encrypted[streamHeaderSize:streamHeaderSize+chunk]...), KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+
+			_, err = decrypt(encrypted, KEY_ALGORITHM_AES_256_GCM, bytes.Repeat([]byte{9}, AES_256_KEY_SIZE))
+			So(err, ShouldNotBeNil)
+			_, err = decrypt(encrypted, KEY_ALGORITHM_SM4_GCM, bytes.Repeat([]byte{2}, SM4_KEY_SIZE))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("with keyring data keys\n", func() {
+			kr, err := NewKeyring(Key{ID: "2025", Material: aesKey, State: KEY_STATE_ACTIVE})
+			So(err, ShouldBeNil)
+
+			var buf bytes.Buffer
+			w, err := kr.NewEncryptWriter(&buf, WithStreamChunkSize(4096))
+			So(err, ShouldBeNil)
+			_, err = w.Write(plain)
+			So(err, ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+
+			r, err := kr.NewDecryptReader(bytes.NewReader(buf.Bytes()))
+			So(err, ShouldBeNil)
+			decrypted, err := io.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(decrypted, plain), ShouldBeTrue)
+
+			_, err = NewDecryptReader(bytes.NewReader(buf.Bytes()), KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+			_, err = kr.NewDecryptReader(bytes.NewReader(encrypt(plain, KEY_ALGORITHM_AES_256_GCM, aesKey)))
+			So(err, ShouldNotBeNil)
+
+			So(kr.SetState("2025", KEY_STATE_RETIRED), ShouldBeNil)
+			_, err = kr.NewDecryptReader(bytes.NewReader(buf.Bytes()))
+			So(errors.Is(err, ErrKeyRetired), ShouldBeTrue)
+		})
+
+		Convey("invalid options\n", func() {
+			var buf bytes.Buffer
+			_, err := NewEncryptWriter(&buf, KEY_ALGORITHM_AES_256_GCM, aesKey, WithStreamChunkSize(0))
+			So(err, ShouldNotBeNil)
+			_, err = NewEncryptWriter(&buf, "AES-128-CTR", aesKey)
+			So(err, ShouldNotBeNil)
+			_, err = NewEncryptWriter(&buf, KEY_ALGORITHM_SM4_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+			_, err = NewDecryptReader(bytes.NewReader([]byte("short")), KEY_ALGORITHM_AES_256_GCM, aesKey)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto"
+)
+
+const (
+	// 加密字段在数据库中的格式为 enc:<密钥ID>:<密文>
+	ENCRYPTED_FIELD_PREFIX = "enc:"
+)
+
+var (
+	ErrFieldEncryptionNotSet = errors.New("db: field encryption is not configured")
+	ErrFieldNotEncrypted     = errors.New("db: field is not encrypted")
+	ErrBlindIndexNotSet      = errors.New("db: blind index key is not configured")
+	ErrFieldBindingNotSet    = errors.New("db: field cipher does not support associated data")
+)
+
+// 字段加密配置项
+// ActiveKeyID: 加密使用的密钥ID, 必须在 Ciphers 中
+// Ciphers: 密钥ID和对应的加解密, 轮换时添加新的密钥并修改 ActiveKeyID, 旧的密文仍可解密, 重新保存时使用新的密钥
+// BlindIndexKey: 盲索引的 HMAC 密钥, 为空时不支持盲索引, 与加密密钥不同, 设置后不能修改
+// AllowPlaintext: 读取到未加密的值时按明文处理, 用于已有的明文列逐步迁移, 否则返回 ErrFieldNotEncrypted
+// 以 enc: 开头的值总是按密文处理, 密钥ID未知或解密失败时返回错误, 迁移前需确认明文列中没有以 enc: 开头的值
+type FieldEncryptionSetting struct {
+	ActiveKeyID    string
+	Ciphers        map[string]crypto.CipherV2
+	BlindIndexKey  []byte
+	AllowPlaintext bool
+}
+
+type fieldEncryption struct {
+	setting    FieldEncryptionSetting
+	blindIndex crypto.VerifiableCipher
+}
+
+var fieldEncryptionConfig atomic.Pointer[fieldEncryption]
+
+// 设置 EncryptedString 使用的加解密, 在读写加密字段之前调用
+// 已设置的 BlindIndexKey 不能修改, 否则已保存的盲索引无法查询
+func SetFieldEncryption(setting FieldEncryptionSetting) error {
+	if current := fieldEncryptionConfig.Load(); current != nil && len(current.setting.BlindIndexKey) > 0 &&
+		!bytes.Equal(current.setting.BlindIndexKey, setting.BlindIndexKey) {
+		return errors.New("blind index key cannot be changed once set")
+	}
+	if _, ok := setting.Ciphers[setting.ActiveKeyID]; !ok {
+		return fmt.Errorf("active key %s has no cipher", setting.ActiveKeyID)
+	}
+	for keyID, ci := range setting.Ciphers {
+		if keyID == "" || strings.Contains(keyID, ":") {
+			return fmt.Errorf("invalid field encryption key id: %q", keyID)
+		}
+		if ci == nil {
+			return fmt.Errorf("key %s has no cipher", keyID)
+		}
+	}
+
+	config := &fieldEncryption{
+		setting: setting,
+	}
+	if len(setting.BlindIndexKey) > 0 {
+		blindIndex, err := crypto.NewHMACCipher(setting.BlindIndexKey)
+		if err != nil {
+			return err
+		}
+		config.blindIndex = blindIndex
+	}
+	fieldEncryptionConfig.Store(config)
+	return nil
+}
+
+// 加密存储的字符串, 内存中为明文, 写入数据库时使用 ActiveKeyID 对应的加解密加密, 读取时按密文中的密钥ID解密
+// 可为空的列使用 sql.Null[EncryptedString]
+// 密文没有绑定所属的记录和字段, 复制到其他记录或字段后仍可解密, 需要绑定时使用 EncryptField 和 DecryptField
+//
+//	type DataSource struct {
+//		Password db.EncryptedString
+//	}
+//	bidx, err := ds.Password.BlindIndex()
+//	_, err = conn.Exec("INSERT INTO t_data_source (f_password, f_password_bidx) VALUES (?, ?)", ds.Password, bidx)
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	config := fieldEncryptionConfig.Load()
+	if config == nil {
+		return nil, ErrFieldEncryptionNotSet
+	}
+
+	keyID := config.setting.ActiveKeyID
+	encrypted, err := config.setting.Ciphers[keyID].Encrypt(context.Background(), string(s))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt field with key %s failed: %w", keyID, err)
+	}
+	return ENCRYPTED_FIELD_PREFIX + keyID + ":" + encrypted, nil
+}
+
+func (s *EncryptedString) Scan(src any) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into EncryptedString", src)
+	}
+
+	config := fieldEncryptionConfig.Load()
+	if config == nil {
+		return ErrFieldEncryptionNotSet
+	}
+
+	if config.setting.AllowPlaintext && !strings.HasPrefix(stored, ENCRYPTED_FIELD_PREFIX) {
+		*s = EncryptedString(stored)
+		return nil
+	}
+
+	keyID, encrypted, err := splitEncryptedField(stored)
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := config.decrypt(keyID, encrypted, nil)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(decrypted)
+	return nil
+}
+
+// 加密字段并绑定到所属的字段和记录, 字段名和记录ID作为附加数据参与认证, 密文复制到其他记录或字段后无法解密
+// ActiveKeyID 对应的加解密需实现 crypto.AEADCipher, 否则返回 ErrFieldBindingNotSet
+//
+//	stored, err := db.EncryptField(password, "t_data_source.f_password", id)
+//	_, err = conn.Exec("UPDATE t_data_source SET f_password = ? WHERE f_id = ?", stored, id)
+func EncryptField(plaintext string, column string, rowID string) (string, error) {
+	config := fieldEncryptionConfig.Load()
+	if config == nil {
+		return "", ErrFieldEncryptionNotSet
+	}
+
+	keyID := config.setting.ActiveKeyID
+	ci, ok := config.setting.Ciphers[keyID].(crypto.AEADCipher)
+	if !ok {
+		return "", fmt.Errorf("%w: key %s", ErrFieldBindingNotSet, keyID)
+	}
+	encrypted, err := ci.EncryptWithAAD(context.Background(), plaintext, fieldAAD(column, rowID))
+	if err != nil {
+		return "", fmt.Errorf("encrypt field with key %s failed: %w", keyID, err)
+	}
+	return ENCRYPTED_FIELD_PREFIX + keyID + ":" + encrypted, nil
+}
+
+// 解密 EncryptField 加密的字段, column 和 rowID 需与加密时相同
+// 不处理 AllowPlaintext, 未加密的值返回 ErrFieldNotEncrypted
+func DecryptField(stored string, column string, rowID string) (string, error) {
+	config := fieldEncryptionConfig.Load()
+	if config == nil {
+		return "", ErrFieldEncryptionNotSet
+	}
+
+	keyID, encrypted, err := splitEncryptedField(stored)
+	if err != nil {
+		return "", err
+	}
+	return config.decrypt(keyID, encrypted, fieldAAD(column, rowID))
+}
+
+// 使用密钥ID对应的加解密解密, aad 不为空时使用附加数据解密
+func (config *fieldEncryption) decrypt(keyID string, encrypted string, aad []byte) (string, error) {
+	ci, ok := config.setting.Ciphers[keyID]
+	if !ok {
+		return "", fmt.Errorf("field encryption key %s has no cipher", keyID)
+	}
+
+	var (
+		decrypted string
+		err       error
+	)
+	if aad == nil {
+		decrypted, err = ci.Decrypt(context.Background(), encrypted)
+	} else if aeadCipher, ok := ci.(crypto.AEADCipher); ok {
+		decrypted, err = aeadCipher.DecryptWithAAD(context.Background(), encrypted, aad)
+	} else {
+		return "", fmt.Errorf("%w: key %s", ErrFieldBindingNotSet, keyID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("decrypt field with key %s failed: %w", keyID, err)
+	}
+	return decrypted, nil
+}
+
+// 字段名和记录ID的附加数据, 字段名不能包含 \x00
+func fieldAAD(column string, rowID string) []byte {
+	return []byte(column + "\x00" + rowID)
+}
+
+// 计算盲索引, 用于加密字段的等值查询, 盲索引需要单独的列保存
+func (s EncryptedString) BlindIndex() (string, error) {
+	return BlindIndex(string(s))
+}
+
+// 计算明文的盲索引, 为 HMAC-SHA256 的 hex 编码
+//
+//	bidx, err := db.BlindIndex(token)
+//	rows, err := conn.Query("SELECT f_id FROM t_token WHERE f_token_bidx = ?", bidx)
+func BlindIndex(plaintext string) (string, error) {
+	config := fieldEncryptionConfig.Load()
+	if config == nil {
+		return "", ErrFieldEncryptionNotSet
+	}
+	if config.blindIndex == nil {
+		return "", ErrBlindIndexNotSet
+	}
+	return config.blindIndex.Signature(context.Background(), plaintext)
+}
+
+// 获取数据库中加密字段使用的密钥ID, 用于查找需要重新加密的数据
+func EncryptedFieldKeyID(stored string) (string, error) {
+	keyID, _, err := splitEncryptedField(stored)
+	return keyID, err
+}
+
+func splitEncryptedField(stored string) (string, string, error) {
+	rest, ok := strings.CutPrefix(stored, ENCRYPTED_FIELD_PREFIX)
+	if !ok {
+		return "", "", ErrFieldNotEncrypted
+	}
+	keyID, encrypted, ok := strings.Cut(rest, ":")
+	if !ok || keyID == "" {
+		return "", "", ErrFieldNotEncrypted
+	}
+	return keyID, encrypted, nil
+}
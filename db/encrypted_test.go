@@ -0,0 +1,193 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto"
+	"github.com/AISHU-Technology/kweaver-go-lib/crypto/mock"
+)
+
+func TestEncryptedString(t *testing.T) {
+	Convey("test encrypted string\n", t, func() {
+		defer fieldEncryptionConfig.Store(nil)
+
+		oldCipher, err := crypto.NewAESGCMCipher(bytes.Repeat([]byte{1}, crypto.AES_256_KEY_SIZE))
+		So(err, ShouldBeNil)
+		newCipher, err := crypto.NewAESGCMCipher(bytes.Repeat([]byte{2}, crypto.AES_256_KEY_SIZE))
+		So(err, ShouldBeNil)
+
+		Convey("not configured\n", func() {
+			_, err := EncryptedString("secret").Value()
+			So(err, ShouldEqual, ErrFieldEncryptionNotSet)
+			var s EncryptedString
+			So(s.Scan("enc:k1:xxx"), ShouldEqual, ErrFieldEncryptionNotSet)
+		})
+
+		Convey("encrypt, decrypt and rotate keys\n", func() {
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k1",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher},
+			}), ShouldBeNil)
+
+			stored, err := EncryptedString("secret").Value()
+			So(err, ShouldBeNil)
+			So(stored, ShouldStartWith, "enc:k1:")
+			keyID, err := EncryptedFieldKeyID(stored.(string))
+			So(err, ShouldBeNil)
+			So(keyID, ShouldEqual, "k1")
+
+			var s EncryptedString
+			So(s.Scan([]byte(stored.(string))), ShouldBeNil)
+			So(s, ShouldEqual, EncryptedString("secret"))
+
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k2",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher, "k2": newCipher},
+			}), ShouldBeNil)
+			So(s.Scan(stored), ShouldBeNil)
+			So(s, ShouldEqual, EncryptedString("secret"))
+
+			reStored, err := s.Value()
+			So(err, ShouldBeNil)
+			So(reStored, ShouldStartWith, "enc:k2:")
+		})
+
+		Convey("null, plaintext and unknown keys\n", func() {
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k1",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher},
+			}), ShouldBeNil)
+
+			s := EncryptedString("previous")
+			So(s.Scan(nil), ShouldBeNil)
+			So(s, ShouldEqual, EncryptedString(""))
+
+			var nullable sql.Null[EncryptedString]
+			So(nullable.Scan(nil), ShouldBeNil)
+			So(nullable.Valid, ShouldBeFalse)
+
+			So(s.Scan("legacy plaintext"), ShouldEqual, ErrFieldNotEncrypted)
+			So(s.Scan("enc:k9:xxx"), ShouldNotBeNil)
+			So(s.Scan(1), ShouldNotBeNil)
+
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID:    "k1",
+				Ciphers:        map[string]crypto.CipherV2{"k1": oldCipher},
+				AllowPlaintext: true,
+			}), ShouldBeNil)
+			So(s.Scan("legacy plaintext"), ShouldBeNil)
+			So(s, ShouldEqual, EncryptedString("legacy plaintext"))
+			// 以 enc: 开头的值不按明文处理, 避免错误的密钥或篡改的密文被当作明文重新加密
+			So(s.Scan("enc:k9:xxx"), ShouldNotBeNil)
+			So(s.Scan("enc:k1:xxx"), ShouldNotBeNil)
+			So(errors.Is(s.Scan("enc:"), ErrFieldNotEncrypted), ShouldBeTrue)
+			So(s, ShouldEqual, EncryptedString("legacy plaintext"))
+		})
+
+		Convey("fields bound to column and row\n", func() {
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k1",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher},
+			}), ShouldBeNil)
+
+			stored, err := EncryptField("secret", "t_user.f_token", "1")
+			So(err, ShouldBeNil)
+			So(stored, ShouldStartWith, "enc:k1:")
+
+			decrypted, err := DecryptField(stored, "t_user.f_token", "1")
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, "secret")
+
+			_, err = DecryptField(stored, "t_user.f_token", "2")
+			So(err, ShouldNotBeNil)
+			_, err = DecryptField(stored, "t_user.f_password", "1")
+			So(err, ShouldNotBeNil)
+			var s EncryptedString
+			So(s.Scan(stored), ShouldNotBeNil)
+
+			_, err = DecryptField("secret", "t_user.f_token", "1")
+			So(errors.Is(err, ErrFieldNotEncrypted), ShouldBeTrue)
+
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k2",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher, "k2": mock.NewMockCipherV2(gomock.NewController(t))},
+			}), ShouldBeNil)
+			_, err = EncryptField("secret", "t_user.f_token", "1")
+			So(errors.Is(err, ErrFieldBindingNotSet), ShouldBeTrue)
+			decrypted, err = DecryptField(stored, "t_user.f_token", "1")
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldEqual, "secret")
+		})
+
+		Convey("blind index\n", func() {
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k1",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher},
+			}), ShouldBeNil)
+			_, err := BlindIndex("secret")
+			So(err, ShouldEqual, ErrBlindIndexNotSet)
+
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID:   "k1",
+				Ciphers:       map[string]crypto.CipherV2{"k1": oldCipher},
+				BlindIndexKey: []byte("bidx-key"),
+			}), ShouldBeNil)
+
+			first, err := EncryptedString("secret").BlindIndex()
+			So(err, ShouldBeNil)
+			second, err := BlindIndex("secret")
+			So(err, ShouldBeNil)
+			So(first, ShouldEqual, second)
+			other, _ := BlindIndex("other")
+			So(other, ShouldNotEqual, first)
+
+			// 密文每次不同, 盲索引相同
+			a, _ := EncryptedString("secret").Value()
+			b, _ := EncryptedString("secret").Value()
+			So(a, ShouldNotEqual, b)
+
+			// 盲索引密钥设置后不能修改或删除
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID:   "k1",
+				Ciphers:       map[string]crypto.CipherV2{"k1": oldCipher},
+				BlindIndexKey: []byte("other-key"),
+			}), ShouldNotBeNil)
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k1",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher},
+			}), ShouldNotBeNil)
+			So(SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID:   "k2",
+				Ciphers:       map[string]crypto.CipherV2{"k1": oldCipher, "k2": newCipher},
+				BlindIndexKey: []byte("bidx-key"),
+			}), ShouldBeNil)
+			third, err := BlindIndex("secret")
+			So(err, ShouldBeNil)
+			So(third, ShouldEqual, first)
+		})
+
+		Convey("invalid settings\n", func() {
+			err := SetFieldEncryption(FieldEncryptionSetting{ActiveKeyID: "k1"})
+			So(err, ShouldNotBeNil)
+			err = SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k:1",
+				Ciphers:     map[string]crypto.CipherV2{"k:1": oldCipher},
+			})
+			So(err, ShouldNotBeNil)
+			err = SetFieldEncryption(FieldEncryptionSetting{
+				ActiveKeyID: "k1",
+				Ciphers:     map[string]crypto.CipherV2{"k1": oldCipher, "k2": nil},
+			})
+			So(err, ShouldNotBeNil)
+
+			_, err = EncryptedFieldKeyID("enc:")
+			So(errors.Is(err, ErrFieldNotEncrypted), ShouldBeTrue)
+		})
+	})
+}
@@ -20,6 +20,7 @@ type Message struct {
 
 	parseOnce      sync.Once
 	parsedTemplate *gotemplate.Template
+	parseErr       error
 }
 
 var (
@@ -137,36 +138,54 @@ func recGetMessages(lang string, messageId string, raw interface{}) error {
 	return nil
 }
 
-// 根据语言获取对应的国际化内容
-func Translate(lang string, messageId string, templateDate map[string]interface{}) string {
+// 判断语言对应的国际化内容是否存在, 用于可选的内容, 避免 Translate 不存在时退出
+func Exists(lang string, messageId string) bool {
 	localizer, ok := iLocalizer[lang]
 	if !ok {
-		logger.Fatalf("the localizer of %s is not exist", lang)
+		return false
+	}
+	_, ok = localizer[messageId]
+	return ok
+}
+
+// 根据语言获取对应的国际化内容, 内容不存在或模板执行失败时退出
+func Translate(lang string, messageId string, templateDate map[string]interface{}) string {
+	data, err := TranslateWithError(lang, messageId, templateDate)
+	if err != nil {
+		logger.Fatalf("%v", err)
 		return ""
 	}
+	return data
+}
+
+// 根据语言获取对应的国际化内容, 内容不存在或模板执行失败时返回错误, 用于不能退出的场景
+func TranslateWithError(lang string, messageId string, templateDate map[string]interface{}) (string, error) {
+	localizer, ok := iLocalizer[lang]
+	if !ok {
+		return "", fmt.Errorf("the localizer of %s is not exist", lang)
+	}
 
 	message, ok := localizer[messageId]
 	if !ok {
-		logger.Fatalf("the messageId %s in localizer %s is not exist", messageId, lang)
-		return ""
+		return "", fmt.Errorf("the messageId %s in localizer %s is not exist", messageId, lang)
 	}
 
 	if !strings.Contains(message.Data, leftDelim) {
-		return message.Data
+		return message.Data, nil
 	}
 
-	var err error
 	message.parseOnce.Do(func() {
-		message.parsedTemplate, err = gotemplate.New("").Parse(message.Data)
-		if err != nil {
-			logger.Fatalf("messageId %s in localizer %s is incorrect, failed to parse the message, message data is '%s'", messageId, lang, message.Data)
-		}
+		message.parsedTemplate, message.parseErr = gotemplate.New("").Parse(message.Data)
 	})
+	if message.parseErr != nil {
+		return "", fmt.Errorf("messageId %s in localizer %s is incorrect, failed to parse the message, message data is '%s': %w",
+			messageId, lang, message.Data, message.parseErr)
+	}
 
 	var buf bytes.Buffer
 	if err := message.parsedTemplate.Execute(&buf, templateDate); err != nil {
-		logger.Fatalf("messageId %s in localizer %s is incorrect, failed to execute the message, message data is '%s', template data is %v", messageId, lang, message.Data, templateDate)
-		return ""
+		return "", fmt.Errorf("messageId %s in localizer %s is incorrect, failed to execute the message, message data is '%s', template data is %v: %w",
+			messageId, lang, message.Data, templateDate, err)
 	}
-	return buf.String()
+	return buf.String(), nil
 }
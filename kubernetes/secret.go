@@ -0,0 +1,16 @@
+package kubernetes
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// 获取 secret, 如用于加载密钥环:
+//
+//	secret, err := client.GetSecret(ctx, "keyring")
+//	keyring, err := crypto.LoadKeyringFromSecret(secret.Data)
+func (k *KubernetesClient) GetSecret(ctx context.Context, name string) (*corev1.Secret, error) {
+	return k.client.CoreV1().Secrets(k.namespace).Get(ctx, name, metav1.GetOptions{})
+}
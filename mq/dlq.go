@@ -0,0 +1,188 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+)
+
+// 死信消息的 Headers, 记录原消息的来源和失败原因
+const (
+	DLQ_HEADER_PREFIX           = "x-dlq-"
+	DLQ_HEADER_ORIGIN_TOPIC     = "x-dlq-origin-topic"
+	DLQ_HEADER_ORIGIN_PARTITION = "x-dlq-origin-partition"
+	DLQ_HEADER_ORIGIN_OFFSET    = "x-dlq-origin-offset"
+	DLQ_HEADER_ERROR            = "x-dlq-error"
+	DLQ_HEADER_ATTEMPTS         = "x-dlq-attempts"
+	DLQ_HEADER_FAILED_AT        = "x-dlq-failed-at"
+)
+
+const (
+	DEFAULT_DLQ_MAX_ATTEMPTS     = 3
+	DEFAULT_DLQ_INITIAL_INTERVAL = 500 * time.Millisecond
+	DEFAULT_DLQ_MAX_INTERVAL     = 30 * time.Second
+)
+
+// 死信配置项
+// Topic: 死信 topic
+// MaxAttempts: 最多处理次数, 包括第一次, 为 0 时默认 3 次
+// InitialInterval、MaxInterval: 指数退避的初始间隔和最大间隔, 为 0 时默认 500ms 和 30s
+type DeadLetterSetting struct {
+	Topic           string
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+// 消费者中间件, 处理失败时按指数退避重试
+// 超过最多处理次数后, 将原消息的内容、Headers、错误和处理次数发送到死信 topic, 并视为处理成功, 避免阻塞分区
+// handler 返回 backoff.Permanent 包装的错误时不再重试, 直接发送到死信 topic
+// 发送死信失败或 ctx 结束时返回错误, 该消息不会被提交
+func WithDeadLetter(producer Producer, setting DeadLetterSetting, handler MessageHandler) MessageHandler {
+	if setting.MaxAttempts <= 0 {
+		setting.MaxAttempts = DEFAULT_DLQ_MAX_ATTEMPTS
+	}
+	if setting.InitialInterval <= 0 {
+		setting.InitialInterval = DEFAULT_DLQ_INITIAL_INTERVAL
+	}
+	if setting.MaxInterval <= 0 {
+		setting.MaxInterval = DEFAULT_DLQ_MAX_INTERVAL
+	}
+
+	return func(ctx context.Context, msg *Message) error {
+		retryBackoff := backoff.NewExponentialBackOff()
+		retryBackoff.InitialInterval = setting.InitialInterval
+		retryBackoff.MaxInterval = setting.MaxInterval
+		retryBackoff.MaxElapsedTime = 0
+
+		attempts := 0
+		err := backoff.Retry(func() error {
+			attempts++
+			return handler(ctx, msg)
+		}, backoff.WithContext(backoff.WithMaxRetries(retryBackoff, uint64(setting.MaxAttempts-1)), ctx))
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		logger.Errorf("handle message %s/%d/%d failed after %d attempts, send to dead letter topic %s: %v",
+			msg.Topic, msg.Partition, msg.Offset, attempts, setting.Topic, err)
+
+		dlqMsg := newDeadLetter(setting.Topic, msg, err, attempts)
+		if pubErr := producer.Publish(ctx, dlqMsg); pubErr != nil {
+			return fmt.Errorf("publish dead letter to %s failed: %w", setting.Topic, pubErr)
+		}
+		return nil
+	}
+}
+
+// 生成死信消息, 保留原消息的 Key、Value 和 Headers
+func newDeadLetter(topic string, msg *Message, err error, attempts int) *Message {
+	headers := make(map[string]string, len(msg.Headers)+6)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[DLQ_HEADER_ORIGIN_TOPIC] = msg.Topic
+	headers[DLQ_HEADER_ORIGIN_PARTITION] = strconv.Itoa(int(msg.Partition))
+	headers[DLQ_HEADER_ORIGIN_OFFSET] = strconv.FormatInt(msg.Offset, 10)
+	headers[DLQ_HEADER_ERROR] = err.Error()
+	headers[DLQ_HEADER_ATTEMPTS] = strconv.Itoa(attempts)
+	headers[DLQ_HEADER_FAILED_AT] = time.Now().Format(time.RFC3339Nano)
+
+	return &Message{
+		Topic:   topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+}
+
+// 死信消息中记录的失败信息
+type DeadLetter struct {
+	OriginTopic     string
+	OriginPartition int32
+	OriginOffset    int64
+	Error           string
+	Attempts        int
+	FailedAt        time.Time
+}
+
+// 解析死信消息的 Headers, 不是死信消息时返回错误
+func ParseDeadLetter(msg *Message) (*DeadLetter, error) {
+	topic, ok := msg.Headers[DLQ_HEADER_ORIGIN_TOPIC]
+	if !ok {
+		return nil, errors.New("message is not a dead letter")
+	}
+
+	deadLetter := &DeadLetter{
+		OriginTopic:     topic,
+		OriginPartition: -1,
+		OriginOffset:    -1,
+		Error:           msg.Headers[DLQ_HEADER_ERROR],
+	}
+	if partition, err := strconv.Atoi(msg.Headers[DLQ_HEADER_ORIGIN_PARTITION]); err == nil {
+		deadLetter.OriginPartition = int32(partition)
+	}
+	if offset, err := strconv.ParseInt(msg.Headers[DLQ_HEADER_ORIGIN_OFFSET], 10, 64); err == nil {
+		deadLetter.OriginOffset = offset
+	}
+	if attempts, err := strconv.Atoi(msg.Headers[DLQ_HEADER_ATTEMPTS]); err == nil {
+		deadLetter.Attempts = attempts
+	}
+	if failedAt, err := time.Parse(time.RFC3339Nano, msg.Headers[DLQ_HEADER_FAILED_AT]); err == nil {
+		deadLetter.FailedAt = failedAt
+	}
+	return deadLetter, nil
+}
+
+// 将死信消息去掉死信 Headers 后发回原 topic
+func ReplayDeadLetter(ctx context.Context, producer Producer, msg *Message) error {
+	deadLetter, err := ParseDeadLetter(msg)
+	if err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		if !strings.HasPrefix(k, DLQ_HEADER_PREFIX) {
+			headers[k] = v
+		}
+	}
+
+	return producer.Publish(ctx, &Message{
+		Topic:   deadLetter.OriginTopic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+}
+
+// 消费死信 topic 并把消息发回原 topic, 阻塞直到 ctx 结束或 consumer 关闭
+// filter 不为 nil 时只重放 filter 返回 true 的消息, 其余消息直接提交
+// consumer 需关闭自动提交, 消息重放成功后才提交
+func ReplayDeadLetters(ctx context.Context, consumer Consumer, producer Producer, dlqTopic string, filter func(*DeadLetter) bool) error {
+	return consumer.Consume(ctx, []string{dlqTopic}, func(ctx context.Context, msg *Message) error {
+		deadLetter, err := ParseDeadLetter(msg)
+		if err != nil {
+			logger.Warnf("skip message %s/%d/%d in dead letter topic: %v", msg.Topic, msg.Partition, msg.Offset, err)
+			return consumer.Commit(msg)
+		}
+
+		if filter == nil || filter(deadLetter) {
+			if err = ReplayDeadLetter(ctx, producer, msg); err != nil {
+				logger.Errorf("replay dead letter %s/%d/%d to %s failed: %v", msg.Topic, msg.Partition, msg.Offset, deadLetter.OriginTopic, err)
+				return err
+			}
+		}
+		return consumer.Commit(msg)
+	})
+}
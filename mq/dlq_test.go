@@ -0,0 +1,108 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeadLetter(t *testing.T) {
+	Convey("test dead letter middleware\n", t, func() {
+		setting := &MQSetting{MQType: MQ_TYPE_MEMORY, MQHost: "dlq"}
+		broker := GetMemoryBroker(setting)
+		defer broker.Reset()
+
+		producer, _ := NewProducer(setting)
+		dlqSetting := DeadLetterSetting{
+			Topic:           "topic.dlq",
+			MaxAttempts:     3,
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+		}
+		msg := &Message{
+			Topic:     "topic",
+			Key:       []byte("key"),
+			Value:     []byte("value"),
+			Headers:   map[string]string{"h": "v"},
+			Partition: 1,
+			Offset:    7,
+		}
+
+		Convey("succeed after retry\n", func() {
+			attempts := 0
+			handler := WithDeadLetter(producer, dlqSetting, func(ctx context.Context, msg *Message) error {
+				attempts++
+				if attempts < 2 {
+					return errors.New("temporary")
+				}
+				return nil
+			})
+			So(handler(context.Background(), msg), ShouldBeNil)
+			So(attempts, ShouldEqual, 2)
+			So(len(broker.Messages("topic.dlq")), ShouldEqual, 0)
+		})
+
+		Convey("send to dead letter topic and replay\n", func() {
+			attempts := 0
+			handler := WithDeadLetter(producer, dlqSetting, func(ctx context.Context, msg *Message) error {
+				attempts++
+				return errors.New("poison")
+			})
+			So(handler(context.Background(), msg), ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+
+			dlqMsgs := broker.Messages("topic.dlq")
+			So(len(dlqMsgs), ShouldEqual, 1)
+			So(string(dlqMsgs[0].Value), ShouldEqual, "value")
+			So(dlqMsgs[0].Headers["h"], ShouldEqual, "v")
+
+			deadLetter, err := ParseDeadLetter(dlqMsgs[0])
+			So(err, ShouldBeNil)
+			So(deadLetter.OriginTopic, ShouldEqual, "topic")
+			So(deadLetter.OriginPartition, ShouldEqual, 1)
+			So(deadLetter.OriginOffset, ShouldEqual, 7)
+			So(deadLetter.Error, ShouldEqual, "poison")
+			So(deadLetter.Attempts, ShouldEqual, 3)
+
+			So(ReplayDeadLetter(context.Background(), producer, dlqMsgs[0]), ShouldBeNil)
+			replayed := broker.Messages("topic")
+			So(len(replayed), ShouldEqual, 1)
+			So(string(replayed[0].Key), ShouldEqual, "key")
+			So(replayed[0].Headers["h"], ShouldEqual, "v")
+			So(replayed[0].Headers, ShouldNotContainKey, DLQ_HEADER_ERROR)
+		})
+
+		Convey("permanent error skips retry\n", func() {
+			attempts := 0
+			handler := WithDeadLetter(producer, dlqSetting, func(ctx context.Context, msg *Message) error {
+				attempts++
+				return backoff.Permanent(errors.New("invalid payload"))
+			})
+			So(handler(context.Background(), msg), ShouldBeNil)
+			So(attempts, ShouldEqual, 1)
+
+			deadLetter, err := ParseDeadLetter(broker.Messages("topic.dlq")[0])
+			So(err, ShouldBeNil)
+			So(deadLetter.Error, ShouldEqual, "invalid payload")
+		})
+
+		Convey("replay dead letters from topic\n", func() {
+			So(producer.Publish(context.Background(), newDeadLetter("topic.dlq", msg, errors.New("poison"), 3)), ShouldBeNil)
+
+			consumer, _ := NewConsumer(setting, ConsumerOptions{GroupID: "replay", FromOldest: true})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go ReplayDeadLetters(ctx, consumer, producer, "topic.dlq", nil)
+
+			waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+			defer waitCancel()
+			replayed, err := broker.WaitMessages(waitCtx, "topic", 1)
+			So(err, ShouldBeNil)
+			So(string(replayed[0].Value), ShouldEqual, "value")
+		})
+	})
+}
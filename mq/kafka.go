@@ -0,0 +1,274 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/observability"
+)
+
+var (
+	PRODUCER_MAX_RETRY    = 5 // 生产者重试次数
+	NET_MAX_OPEN_REQUESTS = 1 // 设置为 1, 确保某一时刻只能发送一个请求, 避免因为 retry 导致的消息乱序
+
+	CONSUMER_RETRY_INITIAL_INTERVAL = 500 * time.Millisecond // 消费者处理失败后重试的初始间隔
+	CONSUMER_RETRY_MAX_INTERVAL     = 30 * time.Second       // 消费者处理失败后重试的最大间隔
+)
+
+// kafka 生产者
+// 消息按 Key 做哈希分区, 相同 Key 的消息写入同一分区
+type kafkaProducer struct {
+	producer sarama.SyncProducer
+}
+
+func NewKafkaProducer(setting *MQSetting) (Producer, error) {
+	config, err := NewSaramaConfig(setting)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = PRODUCER_MAX_RETRY
+	config.Net.MaxOpenRequests = NET_MAX_OPEN_REQUESTS
+
+	producer, err := sarama.NewSyncProducer(GetBrokers(setting), config)
+	if err != nil {
+		logger.Errorf("can not connect to kafka, create kafka producer failed: %v", err)
+		return nil, err
+	}
+
+	return &kafkaProducer{
+		producer: producer,
+	}, nil
+}
+
+func (p *kafkaProducer) Publish(ctx context.Context, msgs ...*Message) (err error) {
+	_, span := startPublishSpan(ctx, msgs)
+	defer func() { observability.TelemetrySpanEnd(span, err) }()
+
+	producerMsgs := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		producerMsg := &sarama.ProducerMessage{
+			Topic: msg.Topic,
+			Value: sarama.ByteEncoder(msg.Value),
+		}
+		if msg.Key != nil {
+			producerMsg.Key = sarama.ByteEncoder(msg.Key)
+		}
+		for k, v := range msg.Headers {
+			producerMsg.Headers = append(producerMsg.Headers, sarama.RecordHeader{
+				Key:   []byte(k),
+				Value: []byte(v),
+			})
+		}
+		producerMsgs = append(producerMsgs, producerMsg)
+	}
+
+	return p.producer.SendMessages(producerMsgs)
+}
+
+func (p *kafkaProducer) Close() error {
+	return p.producer.Close()
+}
+
+// kafka 消费者, 基于消费者组
+type kafkaConsumer struct {
+	group sarama.ConsumerGroup
+	opts  ConsumerOptions
+
+	mu       sync.Mutex
+	sessions map[string]sarama.ConsumerGroupSession // topic/partition 到当前 session 的映射, 用于手动提交
+}
+
+func NewKafkaConsumer(setting *MQSetting, opts ConsumerOptions) (Consumer, error) {
+	if opts.GroupID == "" {
+		return nil, errors.New("kafka consumer group id is empty")
+	}
+
+	config, err := NewSaramaConfig(setting)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.AutoCommit.Enable = opts.AutoCommit
+	if opts.FromOldest {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+
+	group, err := sarama.NewConsumerGroup(GetBrokers(setting), opts.GroupID, config)
+	if err != nil {
+		logger.Errorf("can not connect to kafka, create kafka consumer group failed: %v", err)
+		return nil, err
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DEFAULT_CONSUMER_MAX_ATTEMPTS
+	}
+
+	c := &kafkaConsumer{
+		group:    group,
+		opts:     opts,
+		sessions: make(map[string]sarama.ConsumerGroupSession),
+	}
+
+	go func() {
+		for err := range group.Errors() {
+			logger.Errorf("kafka consumer group %s error: %v", opts.GroupID, err)
+		}
+	}()
+
+	return c, nil
+}
+
+func (c *kafkaConsumer) Consume(ctx context.Context, topics []string, handler MessageHandler) error {
+	groupHandler := &kafkaGroupHandler{
+		consumer: c,
+		handler:  handler,
+	}
+
+	// 重平衡后 Consume 会返回, 需要循环调用以重新加入消费者组
+	for {
+		err := c.group.Consume(ctx, topics, groupHandler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return nil
+		}
+		if err != nil {
+			logger.Errorf("kafka consumer group %s consume failed: %v", c.opts.GroupID, err)
+			return err
+		}
+	}
+}
+
+func (c *kafkaConsumer) Commit(msg *Message) error {
+	c.mu.Lock()
+	session, ok := c.sessions[partitionKey(msg.Topic, msg.Partition)]
+	c.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("partition %s is not assigned to this consumer", partitionKey(msg.Topic, msg.Partition))
+	}
+
+	session.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, "")
+	session.Commit()
+	return nil
+}
+
+func (c *kafkaConsumer) Close() error {
+	return c.group.Close()
+}
+
+func partitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
+// 实现 sarama.ConsumerGroupHandler
+type kafkaGroupHandler struct {
+	consumer *kafkaConsumer
+	handler  MessageHandler
+}
+
+func (h *kafkaGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.consumer.mu.Lock()
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			h.consumer.sessions[partitionKey(topic, partition)] = session
+		}
+	}
+	h.consumer.mu.Unlock()
+
+	if h.consumer.opts.OnAssigned != nil {
+		h.consumer.opts.OnAssigned(session.Claims())
+	}
+	return nil
+}
+
+func (h *kafkaGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	if h.consumer.opts.OnRevoked != nil {
+		h.consumer.opts.OnRevoked(session.Claims())
+	}
+
+	h.consumer.mu.Lock()
+	for topic, partitions := range session.Claims() {
+		for _, partition := range partitions {
+			delete(h.consumer.sessions, partitionKey(topic, partition))
+		}
+	}
+	h.consumer.mu.Unlock()
+	return nil
+}
+
+func (h *kafkaGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case consumerMsg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			msg := &Message{
+				Topic:     consumerMsg.Topic,
+				Key:       consumerMsg.Key,
+				Value:     consumerMsg.Value,
+				Headers:   make(map[string]string, len(consumerMsg.Headers)),
+				Partition: consumerMsg.Partition,
+				Offset:    consumerMsg.Offset,
+				Timestamp: consumerMsg.Timestamp,
+			}
+			for _, header := range consumerMsg.Headers {
+				msg.Headers[string(header.Key)] = string(header.Value)
+			}
+
+			// session 结束时不标记, 重平衡后重新投递
+			if !h.handle(session.Context(), msg) {
+				return nil
+			}
+
+			if h.consumer.opts.AutoCommit {
+				session.MarkMessage(consumerMsg, "")
+			}
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// 处理消息, 失败时按指数退避重试, 最多处理 MaxAttempts 次, 超过后丢弃, 与 NSQ 重新入队的次数一致
+// ctx 结束时返回 false, 消息未处理完成
+func (h *kafkaGroupHandler) handle(ctx context.Context, msg *Message) bool {
+	retryBackoff := backoff.NewExponentialBackOff()
+	retryBackoff.InitialInterval = CONSUMER_RETRY_INITIAL_INTERVAL
+	retryBackoff.MaxInterval = CONSUMER_RETRY_MAX_INTERVAL
+	retryBackoff.MaxElapsedTime = 0
+
+	attempts := 0
+	err := backoff.Retry(func() error {
+		attempts++
+		err := handleWithSpan(ctx, msg, h.handler)
+		if err != nil && attempts < h.consumer.opts.MaxAttempts {
+			logger.Warnf("handle message %s/%d failed, retry %d: %v", partitionKey(msg.Topic, msg.Partition), msg.Offset, attempts, err)
+		}
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(retryBackoff, uint64(h.consumer.opts.MaxAttempts-1)), ctx))
+	if err == nil {
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	logger.Errorf("handle message %s/%d failed after %d attempts, discard it: %v", partitionKey(msg.Topic, msg.Partition), msg.Offset, attempts, err)
+	return true
+}
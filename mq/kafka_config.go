@@ -0,0 +1,117 @@
+package mq
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// 获取 kafka broker 地址列表
+func GetBrokers(setting *MQSetting) []string {
+	if len(setting.Brokers) > 0 {
+		return setting.Brokers
+	}
+	return []string{fmt.Sprintf("%s:%d", setting.MQHost, setting.MQPort)}
+}
+
+// 根据 mq 配置项生成 sarama 的连接配置, 包括 SASL 认证和 TLS
+// 生产者和消费者相关的配置由调用方自行设置
+func NewSaramaConfig(setting *MQSetting) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+
+	if setting.Auth.Username != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = setting.Auth.Username
+		config.Net.SASL.Password = setting.Auth.Password
+
+		switch mechanism := strings.ToUpper(setting.Auth.Mechanism); mechanism {
+		case "", sarama.SASLTypePlaintext:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{HashGeneratorFcn: sha256.New}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{HashGeneratorFcn: sha512.New}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported sasl mechanism: %s", setting.Auth.Mechanism)
+		}
+	}
+
+	if setting.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(setting.TLS)
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	return config, nil
+}
+
+// 生成 TLS 配置
+func newTLSConfig(setting MQTLSSetting) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         setting.ServerName,
+		InsecureSkipVerify: setting.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if setting.CAFile != "" {
+		caPEM, err := os.ReadFile(setting.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file %s failed: %w", setting.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid certificate found in ca file %s", setting.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if setting.CertFile != "" || setting.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(setting.CertFile, setting.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// 基于 xdg-go/scram 实现 sarama.SCRAMClient
+type scramClient struct {
+	*scram.Client
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) (err error) {
+	c.Client, err = c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = c.Client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
@@ -0,0 +1,65 @@
+package mq
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/IBM/sarama"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewSaramaConfig(t *testing.T) {
+	Convey("test NewSaramaConfig\n", t, func() {
+
+		Convey("no auth\n", func() {
+			config, err := NewSaramaConfig(&MQSetting{MQHost: "kafka", MQPort: 9092})
+			So(err, ShouldBeNil)
+			So(config.Net.SASL.Enable, ShouldBeFalse)
+			So(config.Net.TLS.Enable, ShouldBeFalse)
+		})
+
+		Convey("plain by default\n", func() {
+			config, err := NewSaramaConfig(&MQSetting{Auth: MQAuthSetting{Username: "u", Password: "p"}})
+			So(err, ShouldBeNil)
+			So(config.Net.SASL.Enable, ShouldBeTrue)
+			So(string(config.Net.SASL.Mechanism), ShouldEqual, sarama.SASLTypePlaintext)
+		})
+
+		Convey("scram\n", func() {
+			config, err := NewSaramaConfig(&MQSetting{Auth: MQAuthSetting{Username: "u", Password: "p", Mechanism: "scram-sha-512"}})
+			So(err, ShouldBeNil)
+			So(string(config.Net.SASL.Mechanism), ShouldEqual, sarama.SASLTypeSCRAMSHA512)
+			So(config.Net.SASL.SCRAMClientGeneratorFunc().Begin("u", "p", ""), ShouldBeNil)
+		})
+
+		Convey("unsupported mechanism\n", func() {
+			_, err := NewSaramaConfig(&MQSetting{Auth: MQAuthSetting{Username: "u", Mechanism: "GSSAPI"}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("tls\n", func() {
+			config, err := NewSaramaConfig(&MQSetting{TLS: MQTLSSetting{Enabled: true, ServerName: "kafka", InsecureSkipVerify: true}})
+			So(err, ShouldBeNil)
+			So(config.Net.TLS.Enable, ShouldBeTrue)
+			So(config.Net.TLS.Config.ServerName, ShouldEqual, "kafka")
+
+			_, err = NewSaramaConfig(&MQSetting{TLS: MQTLSSetting{Enabled: true, CAFile: "not-exist.pem"}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("tls key file is loaded from json\n", func() {
+			var setting MQTLSSetting
+			So(json.Unmarshal([]byte(`{"certFile": "client.pem", "keyFile": "client.key"}`), &setting), ShouldBeNil)
+			So(setting.CertFile, ShouldEqual, "client.pem")
+			So(setting.KeyFile, ShouldEqual, "client.key")
+		})
+	})
+}
+
+func TestGetBrokers(t *testing.T) {
+	Convey("test GetBrokers\n", t, func() {
+		So(GetBrokers(&MQSetting{MQHost: "kafka", MQPort: 9092}), ShouldResemble, []string{"kafka:9092"})
+		So(GetBrokers(&MQSetting{MQHost: "kafka", MQPort: 9092, Brokers: []string{"k1:9092", "k2:9092"}}),
+			ShouldResemble, []string{"k1:9092", "k2:9092"})
+	})
+}
@@ -0,0 +1,82 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKafkaProducer(t *testing.T) {
+	Convey("test kafka producer publish\n", t, func() {
+		mockProducer := mocks.NewSyncProducer(t, nil)
+		p := &kafkaProducer{producer: mockProducer}
+
+		var sent *sarama.ProducerMessage
+		mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			sent = msg
+			return nil
+		})
+
+		err := p.Publish(context.Background(), &Message{
+			Topic:   "topic",
+			Key:     []byte("key"),
+			Value:   []byte("value"),
+			Headers: map[string]string{"h": "v"},
+		})
+		So(err, ShouldBeNil)
+		So(sent.Topic, ShouldEqual, "topic")
+
+		key, _ := sent.Key.Encode()
+		So(string(key), ShouldEqual, "key")
+		So(len(sent.Headers), ShouldBeGreaterThanOrEqualTo, 1)
+		So(p.Close(), ShouldBeNil)
+	})
+}
+
+func TestKafkaConsumerRetry(t *testing.T) {
+	Convey("test kafka consumer retries failed messages\n", t, func() {
+		initialInterval, maxInterval := CONSUMER_RETRY_INITIAL_INTERVAL, CONSUMER_RETRY_MAX_INTERVAL
+		CONSUMER_RETRY_INITIAL_INTERVAL, CONSUMER_RETRY_MAX_INTERVAL = time.Millisecond, time.Millisecond
+		defer func() {
+			CONSUMER_RETRY_INITIAL_INTERVAL, CONSUMER_RETRY_MAX_INTERVAL = initialInterval, maxInterval
+		}()
+
+		attempts := 0
+		failTimes := 0
+		h := &kafkaGroupHandler{
+			consumer: &kafkaConsumer{opts: ConsumerOptions{MaxAttempts: 3}},
+			handler: func(ctx context.Context, msg *Message) error {
+				attempts++
+				if attempts <= failTimes {
+					return errors.New("handle failed")
+				}
+				return nil
+			},
+		}
+		msg := &Message{Topic: "topic", Headers: map[string]string{}}
+
+		Convey("succeeds after retries\n", func() {
+			failTimes = 2
+			So(h.handle(context.Background(), msg), ShouldBeTrue)
+			So(attempts, ShouldEqual, 3)
+		})
+
+		Convey("discarded after max attempts\n", func() {
+			failTimes = 10
+			So(h.handle(context.Background(), msg), ShouldBeTrue)
+			So(attempts, ShouldEqual, 3)
+		})
+
+		Convey("not marked when the session ends\n", func() {
+			failTimes = 10
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(h.handle(ctx, msg), ShouldBeFalse)
+		})
+	})
+}
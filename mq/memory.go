@@ -0,0 +1,412 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/observability"
+)
+
+const (
+	MEMORY_DEFAULT_PARTITIONS = 1 // 自动创建 topic 时的分区数
+)
+
+var (
+	memoryBrokersMu sync.Mutex
+	memoryBrokers   = map[string]*MemoryBroker{}
+)
+
+// 进程内的 mq, 用于单元测试
+// 支持 topic、分区、消费者组和 offset, 同一消费者组内的多个消费者按分区分配消息
+type MemoryBroker struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	groups map[string]*memoryGroup
+	// 有新消息或消费者组变化时关闭并替换, 用于唤醒等待中的消费者
+	notify chan struct{}
+}
+
+type memoryTopic struct {
+	partitions [][]*Message
+	messages   []*Message // 按发送顺序保存的所有消息
+	next       int        // 没有 Key 时轮询选择分区
+}
+
+type memoryGroup struct {
+	offsets    map[string]int64 // topic/partition 到已提交 offset 的映射
+	members    []*memoryMember
+	generation int
+}
+
+type memoryMember struct {
+	topics []string
+}
+
+// 获取 mq 配置项对应的进程内 mq, 相同地址的配置项共享同一个实例
+// 测试之间需要隔离时使用不同的 MQHost, 或调用 Reset 清空
+func GetMemoryBroker(setting *MQSetting) *MemoryBroker {
+	addr := strings.Join(GetBrokers(setting), ",")
+
+	memoryBrokersMu.Lock()
+	defer memoryBrokersMu.Unlock()
+
+	broker, ok := memoryBrokers[addr]
+	if !ok {
+		broker = NewMemoryBroker()
+		memoryBrokers[addr] = broker
+	}
+	return broker
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: map[string]*memoryTopic{},
+		groups: map[string]*memoryGroup{},
+		notify: make(chan struct{}),
+	}
+}
+
+// 创建 topic, 已存在时不做修改
+func (b *MemoryBroker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.createTopic(topic, partitions)
+}
+
+// 获取 topic 中的所有消息, 按发送顺序排列
+func (b *MemoryBroker) Messages(topic string) []*Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return nil
+	}
+	return append([]*Message{}, t.messages...)
+}
+
+// 等待 topic 中至少有 n 条消息, 返回所有消息, 用于断言异步发送的消息
+func (b *MemoryBroker) WaitMessages(ctx context.Context, topic string, n int) ([]*Message, error) {
+	for {
+		b.mu.Lock()
+		var msgs []*Message
+		if t, ok := b.topics[topic]; ok {
+			msgs = append(msgs, t.messages...)
+		}
+		notify := b.notify
+		b.mu.Unlock()
+
+		if len(msgs) >= n {
+			return msgs, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return msgs, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// 获取消费者组在分区上已提交的 offset, 没有提交过时返回 -1
+func (b *MemoryBroker) CommittedOffset(groupID string, topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group, ok := b.groups[groupID]
+	if !ok {
+		return -1
+	}
+	offset, ok := group.offsets[partitionKey(topic, partition)]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+// 清空所有 topic 和消费者组的 offset
+func (b *MemoryBroker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topics = map[string]*memoryTopic{}
+	for _, group := range b.groups {
+		group.offsets = map[string]int64{}
+		group.generation++
+	}
+	b.broadcast()
+}
+
+func (b *MemoryBroker) createTopic(topic string, partitions int) *memoryTopic {
+	if t, ok := b.topics[topic]; ok {
+		return t
+	}
+	if partitions <= 0 {
+		partitions = MEMORY_DEFAULT_PARTITIONS
+	}
+	t := &memoryTopic{
+		partitions: make([][]*Message, partitions),
+	}
+	b.topics[topic] = t
+	return t
+}
+
+func (b *MemoryBroker) broadcast() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+func (b *MemoryBroker) publish(msgs []*Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		t := b.createTopic(msg.Topic, 0)
+
+		var partition int
+		if msg.Key != nil {
+			h := fnv.New32a()
+			h.Write(msg.Key)
+			partition = int(h.Sum32() % uint32(len(t.partitions)))
+		} else {
+			partition = t.next % len(t.partitions)
+			t.next++
+		}
+
+		stored := copyMessage(msg)
+		stored.Partition = int32(partition)
+		stored.Offset = int64(len(t.partitions[partition]))
+		stored.Timestamp = time.Now()
+		t.partitions[partition] = append(t.partitions[partition], stored)
+		t.messages = append(t.messages, stored)
+	}
+	b.broadcast()
+}
+
+func (b *MemoryBroker) commit(groupID string, msg *Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group, ok := b.groups[groupID]
+	if !ok {
+		return
+	}
+	key := partitionKey(msg.Topic, msg.Partition)
+	if offset, ok := group.offsets[key]; !ok || msg.Offset+1 > offset {
+		group.offsets[key] = msg.Offset + 1
+	}
+}
+
+func (b *MemoryBroker) join(groupID string, member *memoryMember) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group, ok := b.groups[groupID]
+	if !ok {
+		group = &memoryGroup{offsets: map[string]int64{}}
+		b.groups[groupID] = group
+	}
+	for _, topic := range member.topics {
+		b.createTopic(topic, 0)
+	}
+	group.members = append(group.members, member)
+	group.generation++
+	b.broadcast()
+}
+
+func (b *MemoryBroker) leave(groupID string, member *memoryMember) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group := b.groups[groupID]
+	for i, m := range group.members {
+		if m == member {
+			group.members = append(group.members[:i], group.members[i+1:]...)
+			break
+		}
+	}
+	group.generation++
+	b.broadcast()
+}
+
+// 按成员在组内的顺序轮询分配分区, 调用方需持有锁
+func (b *MemoryBroker) assign(group *memoryGroup, member *memoryMember) map[string][]int32 {
+	index := 0
+	for i, m := range group.members {
+		if m == member {
+			index = i
+		}
+	}
+
+	topics := append([]string{}, member.topics...)
+	sort.Strings(topics)
+
+	claims := map[string][]int32{}
+	n := 0
+	for _, topic := range topics {
+		for partition := range b.createTopic(topic, 0).partitions {
+			if n%len(group.members) == index {
+				claims[topic] = append(claims[topic], int32(partition))
+			}
+			n++
+		}
+	}
+	return claims
+}
+
+func copyMessage(msg *Message) *Message {
+	copied := *msg
+	copied.Headers = make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		copied.Headers[k] = v
+	}
+	return &copied
+}
+
+// 进程内 mq 生产者
+type memoryProducer struct {
+	broker *MemoryBroker
+}
+
+func NewMemoryProducer(setting *MQSetting) (Producer, error) {
+	return &memoryProducer{
+		broker: GetMemoryBroker(setting),
+	}, nil
+}
+
+func (p *memoryProducer) Publish(ctx context.Context, msgs ...*Message) (err error) {
+	_, span := startPublishSpan(ctx, msgs)
+	defer func() { observability.TelemetrySpanEnd(span, err) }()
+
+	p.broker.publish(msgs)
+	return nil
+}
+
+func (p *memoryProducer) Close() error {
+	return nil
+}
+
+// 进程内 mq 消费者
+type memoryConsumer struct {
+	broker *MemoryBroker
+	opts   ConsumerOptions
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+}
+
+func NewMemoryConsumer(setting *MQSetting, opts ConsumerOptions) (Consumer, error) {
+	if opts.GroupID == "" {
+		return nil, errors.New("memory consumer group id is empty")
+	}
+
+	return &memoryConsumer{
+		broker:  GetMemoryBroker(setting),
+		opts:    opts,
+		closeCh: make(chan struct{}),
+	}, nil
+}
+
+func (c *memoryConsumer) Consume(ctx context.Context, topics []string, handler MessageHandler) error {
+	member := &memoryMember{topics: topics}
+	c.broker.join(c.opts.GroupID, member)
+
+	var (
+		generation = -1
+		claims     map[string][]int32
+		positions  map[string]int64
+	)
+	defer func() {
+		c.broker.leave(c.opts.GroupID, member)
+		if claims != nil && c.opts.OnRevoked != nil {
+			c.opts.OnRevoked(claims)
+		}
+	}()
+
+	for {
+		var (
+			revoked  map[string][]int32
+			assigned map[string][]int32
+			pending  []*Message
+		)
+
+		c.broker.mu.Lock()
+		group := c.broker.groups[c.opts.GroupID]
+		if group.generation != generation {
+			// 重平衡, 重新分配分区并从已提交的 offset 开始消费
+			revoked = claims
+			generation = group.generation
+			claims = c.broker.assign(group, member)
+			assigned = claims
+			positions = map[string]int64{}
+			for topic, partitions := range claims {
+				for _, partition := range partitions {
+					key := partitionKey(topic, partition)
+					if offset, ok := group.offsets[key]; ok {
+						positions[key] = offset
+					} else if !c.opts.FromOldest {
+						positions[key] = int64(len(c.broker.topics[topic].partitions[partition]))
+					}
+				}
+			}
+		}
+		for topic, partitions := range claims {
+			for _, partition := range partitions {
+				msgs := c.broker.topics[topic].partitions[partition]
+				for offset := positions[partitionKey(topic, partition)]; offset < int64(len(msgs)); offset++ {
+					pending = append(pending, copyMessage(msgs[offset]))
+				}
+			}
+		}
+		notify := c.broker.notify
+		c.broker.mu.Unlock()
+
+		if revoked != nil && c.opts.OnRevoked != nil {
+			c.opts.OnRevoked(revoked)
+		}
+		if assigned != nil && c.opts.OnAssigned != nil {
+			c.opts.OnAssigned(assigned)
+		}
+
+		for _, msg := range pending {
+			if ctx.Err() != nil {
+				return nil
+			}
+			// 与 kafka 一致, 处理失败时不提交, 但继续处理后续消息
+			if err := handleWithSpan(ctx, msg, handler); err == nil && c.opts.AutoCommit {
+				c.broker.commit(c.opts.GroupID, msg)
+			}
+			positions[partitionKey(msg.Topic, msg.Partition)] = msg.Offset + 1
+		}
+
+		if len(pending) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.closeCh:
+			return nil
+		case <-notify:
+		}
+	}
+}
+
+func (c *memoryConsumer) Commit(msg *Message) error {
+	c.broker.commit(c.opts.GroupID, msg)
+	return nil
+}
+
+func (c *memoryConsumer) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+	})
+	return nil
+}
@@ -0,0 +1,102 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	Convey("test memory broker publish\n", t, func() {
+		setting := &MQSetting{MQType: MQ_TYPE_MEMORY, MQHost: "publish"}
+		broker := GetMemoryBroker(setting)
+		broker.CreateTopic("topic", 4)
+		defer broker.Reset()
+
+		p, err := NewProducer(setting)
+		So(err, ShouldBeNil)
+		err = p.Publish(context.Background(),
+			&Message{Topic: "topic", Key: []byte("a"), Value: []byte("1")},
+			&Message{Topic: "topic", Key: []byte("a"), Value: []byte("2")},
+		)
+		So(err, ShouldBeNil)
+
+		msgs := broker.Messages("topic")
+		So(len(msgs), ShouldEqual, 2)
+		So(msgs[0].Partition, ShouldEqual, msgs[1].Partition)
+		So(msgs[0].Offset, ShouldEqual, 0)
+		So(msgs[1].Offset, ShouldEqual, 1)
+		So(string(msgs[1].Value), ShouldEqual, "2")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = broker.WaitMessages(ctx, "topic", 3)
+		So(err, ShouldEqual, context.DeadlineExceeded)
+	})
+
+	Convey("test memory broker consumer group\n", t, func() {
+		setting := &MQSetting{MQType: MQ_TYPE_MEMORY, MQHost: "consume"}
+		broker := GetMemoryBroker(setting)
+		broker.CreateTopic("topic", 2)
+		defer broker.Reset()
+
+		p, _ := NewProducer(setting)
+		for _, key := range []string{"a", "b", "c", "d"} {
+			So(p.Publish(context.Background(), &Message{Topic: "topic", Key: []byte(key)}), ShouldBeNil)
+		}
+
+		Convey("auto commit\n", func() {
+			var mu sync.Mutex
+			var assigned map[string][]int32
+			received := make(chan *Message, 10)
+
+			c, err := NewConsumer(setting, ConsumerOptions{
+				GroupID:    "group",
+				AutoCommit: true,
+				FromOldest: true,
+				OnAssigned: func(claims map[string][]int32) {
+					mu.Lock()
+					assigned = claims
+					mu.Unlock()
+				},
+			})
+			So(err, ShouldBeNil)
+
+			go c.Consume(context.Background(), []string{"topic"}, func(ctx context.Context, msg *Message) error {
+				received <- msg
+				return nil
+			})
+			for i := 0; i < 4; i++ {
+				<-received
+			}
+			So(c.Close(), ShouldBeNil)
+
+			mu.Lock()
+			So(assigned["topic"], ShouldResemble, []int32{0, 1})
+			mu.Unlock()
+
+			committed := broker.CommittedOffset("group", "topic", 0) + broker.CommittedOffset("group", "topic", 1)
+			So(committed, ShouldEqual, 4)
+		})
+
+		Convey("manual commit\n", func() {
+			received := make(chan *Message, 10)
+			c, _ := NewConsumer(setting, ConsumerOptions{GroupID: "manual", FromOldest: true})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go c.Consume(ctx, []string{"topic"}, func(ctx context.Context, msg *Message) error {
+				received <- msg
+				return nil
+			})
+			msg := <-received
+			cancel()
+
+			So(broker.CommittedOffset("manual", msg.Topic, msg.Partition), ShouldEqual, -1)
+			So(c.Commit(msg), ShouldBeNil)
+			So(broker.CommittedOffset("manual", msg.Topic, msg.Partition), ShouldEqual, msg.Offset+1)
+		})
+	})
+}
@@ -1,16 +1,135 @@
 package mq
 
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 认证配置项
+// Mechanism: SASL 认证方式, 可选 PLAIN、SCRAM-SHA-256、SCRAM-SHA-512, 为空时默认 PLAIN
+// Username 为空时不启用 SASL 认证
 type MQAuthSetting struct {
 	Username  string
 	Password  string `json:"-"`
 	Mechanism string
 }
 
+// TLS 配置项
+// CAFile: 校验服务端证书的 CA 证书文件, 为空时使用系统 CA
+// CertFile、KeyFile: 客户端证书和私钥文件, 用于双向认证 (mTLS)
+// ServerName: 校验服务端证书时使用的域名, 为空时使用连接地址
+// InsecureSkipVerify: 跳过服务端证书校验
+type MQTLSSetting struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string `json:"keyFile"`
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
 // mq配置项
+// Brokers: 多个 bootstrap broker 地址, 格式为 host:port, 设置后忽略 MQHost 和 MQPort
 type MQSetting struct {
-	MQType string
-	MQHost string
-	MQPort int
-	Tenant string
-	Auth   MQAuthSetting
+	MQType  string
+	MQHost  string
+	MQPort  int
+	Brokers []string
+	Tenant  string
+	Auth    MQAuthSetting
+	TLS     MQTLSSetting
+}
+
+// mq类型
+const (
+	MQ_TYPE_KAFKA  = "kafka"
+	MQ_TYPE_NSQ    = "nsq"
+	MQ_TYPE_MEMORY = "memory" // 进程内 mq, 用于单元测试
+)
+
+//go:generate mockgen -package mock -source ./mq.go -destination ./mock/mock_mq.go
+
+// 消息
+// Headers 中会携带 trace 上下文, 消费时自动恢复
+// Partition、Offset、Timestamp 只在消费时有效
+type Message struct {
+	Topic     string
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+
+	raw interface{} // 底层客户端的原始消息, 用于手动提交
+}
+
+// 消息处理函数, 多个分区的消息会并发调用, 需保证并发安全
+// 返回错误时不提交该消息的 offset, 但后续消息提交后, 该消息同样不会再被消费
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+// 生产者接口
+type Producer interface {
+	// 发送消息, 所有消息发送成功后返回
+	Publish(ctx context.Context, msgs ...*Message) error
+	Close() error
+}
+
+// 消费者接口
+type Consumer interface {
+	// 订阅 topics 并阻塞消费, 直到 ctx 结束或调用 Close
+	Consume(ctx context.Context, topics []string, handler MessageHandler) error
+	// 手动提交消息的 offset, 只在关闭自动提交时需要调用
+	Commit(msg *Message) error
+	Close() error
+}
+
+// 消费者默认的最多处理次数
+const DEFAULT_CONSUMER_MAX_ATTEMPTS = 5
+
+// 消费者配置项
+// GroupID: 消费者组, NSQ 中对应 channel
+// AutoCommit: 处理成功后自动提交 offset, 为 false 时需调用 Commit 手动提交
+// FromOldest: 消费者组没有已提交的 offset 时, 从最早的消息开始消费, 默认从最新的消息开始
+// OnAssigned: 重平衡后分配到分区时回调, 参数为 topic 到分区列表的映射
+// OnRevoked: 重平衡前分区被回收时回调
+// MaxAttempts: 处理失败时消息最多处理次数, 包括第一次, 超过后丢弃, 为 0 时默认 DEFAULT_CONSUMER_MAX_ATTEMPTS
+// NSQ 中重新入队, Kafka 中在当前分区按指数退避重试, 重试期间阻塞该分区
+// NSQ 没有分区和 offset, 不支持 FromOldest、OnAssigned、OnRevoked
+type ConsumerOptions struct {
+	GroupID     string
+	AutoCommit  bool
+	FromOldest  bool
+	OnAssigned  func(claims map[string][]int32)
+	OnRevoked   func(claims map[string][]int32)
+	MaxAttempts int
+}
+
+// 根据 mq 类型创建生产者
+func NewProducer(setting *MQSetting) (Producer, error) {
+	switch setting.MQType {
+	case MQ_TYPE_KAFKA:
+		return NewKafkaProducer(setting)
+	case MQ_TYPE_NSQ:
+		return NewNSQProducer(setting)
+	case MQ_TYPE_MEMORY:
+		return NewMemoryProducer(setting)
+	default:
+		return nil, fmt.Errorf("unsupported mq type: %s", setting.MQType)
+	}
+}
+
+// 根据 mq 类型创建消费者
+func NewConsumer(setting *MQSetting, opts ConsumerOptions) (Consumer, error) {
+	switch setting.MQType {
+	case MQ_TYPE_KAFKA:
+		return NewKafkaConsumer(setting, opts)
+	case MQ_TYPE_NSQ:
+		return NewNSQConsumer(setting, opts)
+	case MQ_TYPE_MEMORY:
+		return NewMemoryConsumer(setting, opts)
+	default:
+		return nil, fmt.Errorf("unsupported mq type: %s", setting.MQType)
+	}
 }
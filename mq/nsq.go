@@ -0,0 +1,280 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/nsqio/go-nsq"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/logger"
+	"github.com/AISHU-Technology/kweaver-go-lib/observability"
+)
+
+const (
+	NSQ_RETRY_INTERVAL = 100 * time.Millisecond // 生产者重试间隔
+)
+
+// nsq 消息只有消息体, Key 和 Headers 与消息体一起封装后发送
+// 以魔数开头, 消费到没有魔数的消息时整体作为 Value, 兼容其他客户端发送的消息
+var nsqEnvelopeMagic = []byte{0x00, 'K', 'M', 'Q'}
+
+type nsqEnvelope struct {
+	Key     []byte            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Value   []byte            `json:"value"`
+}
+
+func encodeNSQMessage(msg *Message) ([]byte, error) {
+	body, err := sonic.Marshal(nsqEnvelope{
+		Key:     msg.Key,
+		Headers: msg.Headers,
+		Value:   msg.Value,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal nsq message failed: %w", err)
+	}
+	return append(append([]byte{}, nsqEnvelopeMagic...), body...), nil
+}
+
+func decodeNSQMessage(body []byte) *Message {
+	if !bytes.HasPrefix(body, nsqEnvelopeMagic) {
+		return &Message{Value: body, Headers: map[string]string{}}
+	}
+
+	var envelope nsqEnvelope
+	if err := sonic.Unmarshal(body[len(nsqEnvelopeMagic):], &envelope); err != nil {
+		return &Message{Value: body, Headers: map[string]string{}}
+	}
+	if envelope.Headers == nil {
+		envelope.Headers = map[string]string{}
+	}
+	return &Message{
+		Key:     envelope.Key,
+		Value:   envelope.Value,
+		Headers: envelope.Headers,
+	}
+}
+
+// 根据 mq 配置项生成 nsq 的连接配置, 包括认证和 TLS
+// nsq 只支持 auth secret 认证, 使用 Auth.Password 作为 secret
+func newNSQConfig(setting *MQSetting) (*nsq.Config, error) {
+	config := nsq.NewConfig()
+
+	if setting.Auth.Password != "" {
+		config.AuthSecret = setting.Auth.Password
+	}
+
+	if setting.TLS.Enabled {
+		tlsConfig, err := newTLSConfig(setting.TLS)
+		if err != nil {
+			return nil, err
+		}
+		config.TlsV1 = true
+		config.TlsConfig = tlsConfig
+	}
+
+	return config, nil
+}
+
+// nsq 生产者
+// 配置多个 nsqd 地址时, 发送失败后依次切换到下一个 nsqd 重试
+type nsqProducer struct {
+	producers []*nsq.Producer
+}
+
+func NewNSQProducer(setting *MQSetting) (Producer, error) {
+	config, err := newNSQConfig(setting)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &nsqProducer{}
+	for _, addr := range GetBrokers(setting) {
+		producer, err := nsq.NewProducer(addr, config)
+		if err != nil {
+			p.Close()
+			logger.Errorf("create nsq producer on %s failed: %v", addr, err)
+			return nil, err
+		}
+		producer.SetLoggerLevel(nsq.LogLevelWarning)
+		p.producers = append(p.producers, producer)
+	}
+
+	return p, nil
+}
+
+func (p *nsqProducer) Publish(ctx context.Context, msgs ...*Message) (err error) {
+	_, span := startPublishSpan(ctx, msgs)
+	defer func() { observability.TelemetrySpanEnd(span, err) }()
+
+	// 按 topic 分组, 每个 topic 批量发送
+	topics := []string{}
+	bodies := map[string][][]byte{}
+	for _, msg := range msgs {
+		body, err := encodeNSQMessage(msg)
+		if err != nil {
+			return err
+		}
+		if _, ok := bodies[msg.Topic]; !ok {
+			topics = append(topics, msg.Topic)
+		}
+		bodies[msg.Topic] = append(bodies[msg.Topic], body)
+	}
+
+	for _, topic := range topics {
+		if err = p.publish(ctx, topic, bodies[topic]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *nsqProducer) publish(ctx context.Context, topic string, bodies [][]byte) error {
+	var err error
+	for i := 0; i <= PRODUCER_MAX_RETRY; i++ {
+		producer := p.producers[i%len(p.producers)]
+		if err = producer.MultiPublish(topic, bodies); err == nil {
+			return nil
+		}
+		logger.Warnf("publish nsq message to %s failed, retry %d: %v", producer.String(), i, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(NSQ_RETRY_INTERVAL):
+		}
+	}
+	return err
+}
+
+func (p *nsqProducer) Close() error {
+	for _, producer := range p.producers {
+		producer.Stop()
+	}
+	return nil
+}
+
+// nsq 消费者
+// 处理失败的消息重新入队, 超过 MaxAttempts 次后丢弃
+// 关闭自动提交时, 未调用 Commit 的消息在 nsqd 的消息超时后重新投递
+type nsqConsumer struct {
+	setting *MQSetting
+	config  *nsq.Config
+	opts    ConsumerOptions
+
+	closeCh chan struct{}
+}
+
+func NewNSQConsumer(setting *MQSetting, opts ConsumerOptions) (Consumer, error) {
+	if opts.GroupID == "" {
+		return nil, errors.New("nsq consumer channel is empty")
+	}
+
+	config, err := newNSQConfig(setting)
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DEFAULT_CONSUMER_MAX_ATTEMPTS
+	}
+	if maxAttempts > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid nsq consumer max attempts: %d", maxAttempts)
+	}
+	config.MaxAttempts = uint16(maxAttempts)
+
+	return &nsqConsumer{
+		setting: setting,
+		config:  config,
+		opts:    opts,
+		closeCh: make(chan struct{}),
+	}, nil
+}
+
+func (c *nsqConsumer) Consume(ctx context.Context, topics []string, handler MessageHandler) error {
+	consumers := make([]*nsq.Consumer, 0, len(topics))
+	defer func() {
+		for _, consumer := range consumers {
+			consumer.Stop()
+			<-consumer.StopChan
+		}
+	}()
+
+	for _, topic := range topics {
+		consumer, err := nsq.NewConsumer(topic, c.opts.GroupID, c.config)
+		if err != nil {
+			logger.Errorf("create nsq consumer on topic %s failed: %v", topic, err)
+			return err
+		}
+		consumer.SetLoggerLevel(nsq.LogLevelWarning)
+		consumer.AddHandler(&nsqHandler{
+			ctx:        ctx,
+			topic:      topic,
+			autoCommit: c.opts.AutoCommit,
+			handler:    handler,
+		})
+		consumers = append(consumers, consumer)
+
+		if err = consumer.ConnectToNSQDs(GetBrokers(c.setting)); err != nil {
+			logger.Errorf("can not connect to nsqd, consume topic %s failed: %v", topic, err)
+			return err
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-c.closeCh:
+	}
+	return nil
+}
+
+func (c *nsqConsumer) Commit(msg *Message) error {
+	nsqMsg, ok := msg.raw.(*nsq.Message)
+	if !ok {
+		return errors.New("message is not consumed from nsq")
+	}
+	nsqMsg.Finish()
+	return nil
+}
+
+func (c *nsqConsumer) Close() error {
+	select {
+	case <-c.closeCh:
+	default:
+		close(c.closeCh)
+	}
+	return nil
+}
+
+// 实现 nsq.Handler
+type nsqHandler struct {
+	ctx        context.Context
+	topic      string
+	autoCommit bool
+	handler    MessageHandler
+}
+
+func (h *nsqHandler) HandleMessage(nsqMsg *nsq.Message) error {
+	if !h.autoCommit {
+		nsqMsg.DisableAutoResponse()
+	}
+
+	msg := decodeNSQMessage(nsqMsg.Body)
+	msg.Topic = h.topic
+	msg.Timestamp = time.Unix(0, nsqMsg.Timestamp)
+	msg.raw = nsqMsg
+
+	err := handleWithSpan(h.ctx, msg, h.handler)
+	if err != nil {
+		logger.Errorf("handle nsq message on topic %s failed, attempts %d: %v", h.topic, nsqMsg.Attempts, err)
+		if !h.autoCommit {
+			nsqMsg.Requeue(-1)
+		}
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package mq
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNSQMessage(t *testing.T) {
+	Convey("test nsq message encode and decode\n", t, func() {
+
+		Convey("round trip with key and headers\n", func() {
+			body, err := encodeNSQMessage(&Message{
+				Key:     []byte("key"),
+				Value:   []byte("value"),
+				Headers: map[string]string{"traceparent": "00-1-2-01"},
+			})
+			So(err, ShouldBeNil)
+
+			msg := decodeNSQMessage(body)
+			So(string(msg.Key), ShouldEqual, "key")
+			So(string(msg.Value), ShouldEqual, "value")
+			So(msg.Headers["traceparent"], ShouldEqual, "00-1-2-01")
+		})
+
+		Convey("raw body from other clients\n", func() {
+			msg := decodeNSQMessage([]byte(`{"value":"x"}`))
+			So(string(msg.Value), ShouldEqual, `{"value":"x"}`)
+			So(msg.Key, ShouldBeNil)
+		})
+	})
+
+	Convey("test nsq consumer commit\n", t, func() {
+		c, err := NewConsumer(&MQSetting{MQType: MQ_TYPE_NSQ, MQHost: "nsqd", MQPort: 4150}, ConsumerOptions{GroupID: "channel"})
+		So(err, ShouldBeNil)
+		So(c.Commit(&Message{}), ShouldNotBeNil)
+		So(c.Close(), ShouldBeNil)
+		So(c.Close(), ShouldBeNil)
+	})
+
+	Convey("test nsq consumer max attempts\n", t, func() {
+		setting := &MQSetting{MQType: MQ_TYPE_NSQ, MQHost: "nsqd", MQPort: 4150}
+		c, err := NewNSQConsumer(setting, ConsumerOptions{GroupID: "channel"})
+		So(err, ShouldBeNil)
+		So(c.(*nsqConsumer).config.MaxAttempts, ShouldEqual, DEFAULT_CONSUMER_MAX_ATTEMPTS)
+
+		c, err = NewNSQConsumer(setting, ConsumerOptions{GroupID: "channel", MaxAttempts: 10})
+		So(err, ShouldBeNil)
+		So(c.(*nsqConsumer).config.MaxAttempts, ShouldEqual, 10)
+
+		_, err = NewNSQConsumer(setting, ConsumerOptions{GroupID: "channel", MaxAttempts: 1 << 16})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,39 @@
+package mq
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/AISHU-Technology/kweaver-go-lib/observability"
+)
+
+// 创建生产者 span, 并把 trace 上下文注入到消息的 Headers 中
+func startPublishSpan(ctx context.Context, msgs []*Message) (context.Context, trace.Span) {
+	ctx, span := observability.StartProducerSpan(ctx)
+	for _, msg := range msgs {
+		if msg.Headers == nil {
+			msg.Headers = make(map[string]string)
+		}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(msg.Headers))
+	}
+	return ctx, span
+}
+
+// 从消息的 Headers 中恢复 trace 上下文, 并创建消费者 span
+func startConsumeSpan(ctx context.Context, msg *Message) (context.Context, trace.Span) {
+	if msg.Headers != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Headers))
+	}
+	return observability.StartConsumerSpan(ctx)
+}
+
+// 调用消息处理函数, 处理结果记录到消费者 span 中
+func handleWithSpan(ctx context.Context, msg *Message, handler MessageHandler) error {
+	ctx, span := startConsumeSpan(ctx, msg)
+	err := handler(ctx, msg)
+	observability.TelemetrySpanEnd(span, err)
+	return err
+}
@@ -112,6 +112,29 @@ type Visitor struct {
 	ClientType ClientType
 }
 
+const VisitorKey key = "X-Visitor"
+
+// WithVisitor 将访问者信息存入 context
+func WithVisitor(ctx context.Context, visitor Visitor) context.Context {
+	return context.WithValue(ctx, VisitorKey, visitor)
+}
+
+// GetVisitorByCtx 从 context 中获取访问者信息
+func GetVisitorByCtx(ctx context.Context) (Visitor, bool) {
+	visitor, ok := ctx.Value(VisitorKey).(Visitor)
+	return visitor, ok
+}
+
+// GetVisitor 获取 VerifyToken 校验通过的访问者信息, 不存在时从请求的 context 中获取
+func GetVisitor(c *gin.Context) (Visitor, bool) {
+	if v, ok := c.Get(string(VisitorKey)); ok {
+		if visitor, ok := v.(Visitor); ok {
+			return visitor, true
+		}
+	}
+	return GetVisitorByCtx(c.Request.Context())
+}
+
 //go:generate mockgen -package mock -source ./hydra.go -destination ./mock/mock_hydra.go
 
 // Hydra 授权服务接口
@@ -246,6 +269,7 @@ func (h *hydra) VerifyToken(ctx context.Context, c *gin.Context) (Visitor, error
 		ClientType: info.ClientTyp,
 		ClientID:   info.ClientID,
 	}
+	c.Set(string(VisitorKey), visitor)
 
 	return visitor, nil
 }
@@ -14,6 +14,8 @@ import (
 const (
 	ContentTypeKey  = "Content-Type"
 	ContentTypeJson = "application/json"
+
+	ReplyErrorKey = "X-Reply-Error" // ReplyError 响应的错误, 供中间件读取
 )
 
 // ReplyOK 响应成功
@@ -44,6 +46,8 @@ func ReplyOkWithHeaders(c *gin.Context, statusCode int, body interface{}, header
 
 // ReplyError 响应错误
 func ReplyError(c *gin.Context, err error) {
+	c.Set(ReplyErrorKey, err)
+
 	var statusCode int
 	var body string
 	switch e := err.(type) {
@@ -60,6 +64,13 @@ func ReplyError(c *gin.Context, err error) {
 	c.String(statusCode, body)
 }
 
+// GetReplyError 获取 ReplyError 响应的错误, 没有时返回 nil
+func GetReplyError(c *gin.Context) error {
+	v, _ := c.Get(ReplyErrorKey)
+	err, _ := v.(error)
+	return err
+}
+
 func ReplyErrorWithHeaders(c *gin.Context, err error, headers map[string]string) {
 	addHeaders(c, headers)
 	ReplyError(c, err)